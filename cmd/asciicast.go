@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// AsciicastOptions controls the timing of an asciicast export.
+type AsciicastOptions struct {
+	// TypingDelay is the time between typed characters of a command.
+	TypingDelay time.Duration
+	// OutputDelay is the time between pressing enter and the output.
+	OutputDelay time.Duration
+	// EntryDelay is the pause after each entry's output.
+	EntryDelay time.Duration
+	// Section, if set, limits the recording to the title and the named
+	// section.
+	Section string
+}
+
+// Default asciicast timings.
+const (
+	DefaultTypingDelay = 40 * time.Millisecond
+	DefaultOutputDelay = 300 * time.Millisecond
+	DefaultEntryDelay  = 1500 * time.Millisecond
+)
+
+// asciicastPrompt is the shell prompt shown before each command, and
+// asciicastContinuation the prompt for its continuation lines.
+const (
+	asciicastPrompt       = "\x1b[32m$\x1b[0m "
+	asciicastContinuation = "> "
+)
+
+// asciicastHeader is the first line of an asciicast v2 file.
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env"`
+}
+
+// ExportAsciicast writes a showboat document to w as an asciicast v2
+// recording with the default timings.
+func ExportAsciicast(file string, w io.Writer) error {
+	return ExportAsciicastWithOptions(file, w, AsciicastOptions{})
+}
+
+// ExportAsciicastWithOptions writes a showboat document to w as an asciicast
+// v2 recording that plays back like a terminal session, using the recorded
+// output rather than running anything. Each code block is typed at a prompt
+// and followed by its output; code in languages other than shells is typed
+// as a heredoc for its interpreter. Commentary and headings are shown as
+// shell comments and images as a placeholder. Setup blocks are left out.
+// Zero timings in opts use the defaults.
+func ExportAsciicastWithOptions(file string, w io.Writer, opts AsciicastOptions) error {
+	if opts.TypingDelay == 0 {
+		opts.TypingDelay = DefaultTypingDelay
+	}
+	if opts.OutputDelay == 0 {
+		opts.OutputDelay = DefaultOutputDelay
+	}
+	if opts.EntryDelay == 0 {
+		opts.EntryDelay = DefaultEntryDelay
+	}
+
+	blocks, err := readSection(file, opts.Section)
+	if err != nil {
+		return err
+	}
+
+	rec := &recording{}
+	header := asciicastHeader{
+		Version: 2,
+		Width:   80,
+		Height:  24,
+		Env:     map[string]string{"SHELL": "/bin/bash", "TERM": "xterm-256color"},
+	}
+	for i := 0; i < len(blocks); i++ {
+		switch b := blocks[i].(type) {
+		case markdown.TitleBlock:
+			header.Title = strings.Join(strings.Fields(b.Title), " ")
+			if t, err := time.Parse(time.RFC3339, b.Timestamp); err == nil {
+				header.Timestamp = t.Unix()
+			}
+		case markdown.CommentaryBlock:
+			rec.comment(b.Text)
+			rec.wait(opts.EntryDelay)
+		case markdown.HeadingBlock:
+			rec.print("\x1b[1m# " + b.Title + "\x1b[0m\r\n")
+			rec.wait(opts.EntryDelay)
+		case markdown.CodeBlock:
+			var output markdown.Block
+			if i+1 < len(blocks) {
+				switch blocks[i+1].(type) {
+				case markdown.OutputBlock, markdown.ImageOutputBlock:
+					output = blocks[i+1]
+					i++
+				}
+			}
+			if b.Setup {
+				continue
+			}
+			// Only show the command for images that a script generated.
+			if !b.IsImage || b.Run {
+				rec.typeCommand(asciicastCommand(b), opts.TypingDelay)
+				rec.wait(opts.OutputDelay)
+			}
+			switch out := output.(type) {
+			case markdown.OutputBlock:
+				rec.print(terminalText(out.Content))
+			case markdown.ImageOutputBlock:
+				rec.comment("[image: " + out.AltText + "]")
+			}
+			rec.wait(opts.EntryDelay)
+		}
+	}
+	rec.print(asciicastPrompt)
+
+	for _, line := range strings.Split(rec.text(), "\n") {
+		if n := len([]rune(line)); n > header.Width {
+			header.Width = min(n, 200)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	for _, e := range rec.events {
+		if err := enc.Encode([]any{e.seconds(), "o", e.data}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// asciicastCommand returns what is typed at the prompt to run b: shell code
+// as it is, and other code as a heredoc for its interpreter.
+func asciicastCommand(b markdown.CodeBlock) string {
+	if ext, _ := tangleFile(b.Lang); ext == ".sh" || ext == ".zsh" {
+		return b.Code
+	}
+	delim := heredocDelimiter(b.Code)
+	return b.Lang + " <<'" + delim + "'\n" + b.Code + "\n" + delim
+}
+
+// terminalText converts newlines in text to the CRLF a terminal expects,
+// ending it with a newline.
+func terminalText(text string) string {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return strings.ReplaceAll(text, "\n", "\r\n")
+}
+
+// recording collects the output events of an asciicast.
+type recording struct {
+	now    time.Duration
+	events []castEvent
+}
+
+// castEvent is output written to the terminal at a time.
+type castEvent struct {
+	time time.Duration
+	data string
+}
+
+// seconds returns the event time in seconds, rounded to microseconds.
+func (e castEvent) seconds() float64 {
+	return float64(e.time.Microseconds()) / 1e6
+}
+
+// wait advances the recording clock.
+func (r *recording) wait(d time.Duration) {
+	r.now += d
+}
+
+// print writes data at the current time.
+func (r *recording) print(data string) {
+	if data != "" {
+		r.events = append(r.events, castEvent{r.now, data})
+	}
+}
+
+// comment prints text as dimmed shell comment lines.
+func (r *recording) comment(text string) {
+	var sb strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		sb.WriteString("\x1b[2m# " + line + "\x1b[0m\r\n")
+	}
+	r.print(sb.String())
+}
+
+// typeCommand shows a prompt and types command one character at a time,
+// then presses enter.
+func (r *recording) typeCommand(command string, delay time.Duration) {
+	r.print(asciicastPrompt)
+	for _, c := range command {
+		r.wait(delay)
+		if c == '\n' {
+			r.print("\r\n" + asciicastContinuation)
+			continue
+		}
+		r.print(string(c))
+	}
+	r.wait(delay)
+	r.print("\r\n")
+}
+
+// text returns everything printed, without escape sequences or carriage
+// returns.
+func (r *recording) text() string {
+	var sb strings.Builder
+	for _, e := range r.events {
+		sb.WriteString(e.data)
+	}
+	return stripEscapes(strings.ReplaceAll(sb.String(), "\r", ""))
+}
+
+// stripEscapes removes the SGR escape sequences used in recordings.
+func stripEscapes(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\x1b' {
+			end := strings.IndexByte(s[i:], 'm')
+			if end != -1 {
+				i += end
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestExportAsciicast(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Cast", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecBlock(file, markdown.CodeBlock{Lang: "bash", Code: "echo setup", Setup: true}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "Say hi."); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hi", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "python3", "print(1)", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	opts := AsciicastOptions{TypingDelay: 10 * time.Millisecond, OutputDelay: 100 * time.Millisecond, EntryDelay: time.Second}
+	if err := ExportAsciicastWithOptions(file, &buf, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	scanner.Scan()
+	var header asciicastHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != 2 || header.Title != "Cast" || header.Width != 80 || header.Timestamp == 0 {
+		t.Errorf("unexpected header: %+v", header)
+	}
+
+	var text strings.Builder
+	last := 0.0
+	var events []float64
+	for scanner.Scan() {
+		var event []any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		at, kind := event[0].(float64), event[1].(string)
+		if kind != "o" || at < last {
+			t.Fatalf("bad event %v after %v", event, last)
+		}
+		last = at
+		events = append(events, at)
+		text.WriteString(event[2].(string))
+	}
+
+	want := "\x1b[2m# Say hi.\x1b[0m\r\n" +
+		asciicastPrompt + "echo hi\r\nhi\r\n" +
+		asciicastPrompt + "python3 <<'SHOWBOAT_EOF'\r\n> print(1)\r\n> SHOWBOAT_EOF\r\n1\r\n" +
+		asciicastPrompt
+	if text.String() != want {
+		t.Errorf("got  %q\nwant %q", text.String(), want)
+	}
+	if strings.Contains(text.String(), "setup") {
+		t.Error("setup blocks should be left out")
+	}
+	// "echo hi" is typed after the note's pause, one character at a time.
+	if events[1] != 1 || events[2] != 1.01 {
+		t.Errorf("unexpected typing times: %v", events[:3])
+	}
+}
@@ -0,0 +1,293 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	execpkg "github.com/simonw/showboat/exec"
+	"github.com/simonw/showboat/markdown"
+)
+
+// documentMetadata returns the front matter metadata of a parsed document.
+func documentMetadata(blocks []markdown.Block) markdown.Metadata {
+	if len(blocks) == 0 {
+		return markdown.Metadata{}
+	}
+	tb, ok := blocks[0].(markdown.TitleBlock)
+	if !ok {
+		return markdown.Metadata{}
+	}
+	return tb.Metadata
+}
+
+// imageCopyOptions returns the options for storing images in a document,
+// as configured by its front matter.
+func imageCopyOptions(blocks []markdown.Block) execpkg.CopyOptions {
+	return execpkg.CopyOptions{
+		ContentHash: documentMetadata(blocks).ImageNames == markdown.ImageNamesHash,
+	}
+}
+
+// assetDir returns the directory that images of the document at file are
+// copied into, creating it if needed, and the slash-separated prefix that
+// image references in the document use for it ("" for the document's own
+// directory).
+func assetDir(file string, blocks []markdown.Block) (dir, prefix string, err error) {
+	assets := documentMetadata(blocks).Assets
+	if assets == "" {
+		return filepath.Dir(file), "", nil
+	}
+	if err := checkAssets(assets); err != nil {
+		return "", "", err
+	}
+	dir = filepath.Join(filepath.Dir(file), filepath.FromSlash(assets))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", fmt.Errorf("creating assets directory: %w", err)
+	}
+	return dir, filepath.ToSlash(filepath.Clean(assets)), nil
+}
+
+// checkAssets returns an error unless assets names a directory inside the
+// document's directory. Paths escaping it, such as "../..", are rejected so
+// that "gc" never deletes files outside it.
+func checkAssets(assets string) error {
+	if !filepath.IsLocal(filepath.FromSlash(assets)) {
+		return fmt.Errorf("assets directory must be inside the document's directory: %s", assets)
+	}
+	return nil
+}
+
+// generatedImageName matches the filenames CopyImage generates: either
+// <uuid8>-<date>.<ext> or a <hash16>.<ext> content-addressed name.
+var generatedImageName = regexp.MustCompile(`^(?:[0-9a-f]{8}-\d{4}-\d{2}-\d{2}|[0-9a-f]{16})\.[a-z]+$`)
+
+// GCResult reports what GC found.
+type GCResult struct {
+	// Removed lists image files that were deleted (or would be, for a dry
+	// run) because nothing references them.
+	Removed []string
+	// Missing lists image references whose files do not exist.
+	Missing []string
+}
+
+// GCOptions controls GC.
+type GCOptions struct {
+	// DryRun reports the files that would be deleted without deleting them.
+	DryRun bool
+	// KeepUndo keeps images referenced by the earlier states in the
+	// document's journal, so Undo can still restore them.
+	KeepUndo bool
+}
+
+// GC deletes image files in a document's asset directory that are no longer
+// referenced by any ImageOutputBlock, and reports references to missing
+// files. Only files with names generated by showboat are considered, and
+// images referenced by other showboat documents in the same directory are
+// kept.
+func GC(file string, opts GCOptions) (GCResult, error) {
+	var result GCResult
+
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return result, err
+	}
+
+	docDir := filepath.Dir(file)
+	dir := docDir
+	if assets := documentMetadata(blocks).Assets; assets != "" {
+		if err := checkAssets(assets); err != nil {
+			return result, err
+		}
+		dir = filepath.Join(docDir, filepath.FromSlash(assets))
+	}
+
+	for _, ref := range imageRefs(blocks) {
+		if _, err := os.Stat(filepath.Join(docDir, filepath.FromSlash(ref))); err != nil {
+			result.Missing = append(result.Missing, ref)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return result, fmt.Errorf("reading assets directory: %w", err)
+	}
+
+	referenced, err := referencedImages(file, blocks, opts.KeepUndo)
+	if err != nil {
+		return result, err
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !generatedImageName.MatchString(entry.Name()) {
+			continue
+		}
+		imgPath := filepath.Join(dir, entry.Name())
+		abs, err := filepath.Abs(imgPath)
+		if err != nil {
+			return result, err
+		}
+		if referenced[abs] {
+			continue
+		}
+		if !opts.DryRun {
+			if err := os.Remove(imgPath); err != nil {
+				return result, fmt.Errorf("removing image: %w", err)
+			}
+		}
+		result.Removed = append(result.Removed, imgPath)
+	}
+	return result, nil
+}
+
+// imageRefs returns the image filenames referenced by ImageOutputBlocks.
+func imageRefs(blocks []markdown.Block) []string {
+	var refs []string
+	for _, block := range blocks {
+		if img, ok := block.(markdown.ImageOutputBlock); ok {
+			refs = append(refs, img.Filename)
+		}
+	}
+	return refs
+}
+
+// referencedImages returns the absolute paths of images referenced by the
+// given document and by every other markdown document in its directory,
+// and with keepUndo by the earlier states in its journal.
+func referencedImages(file string, blocks []markdown.Block, keepUndo bool) (map[string]bool, error) {
+	referenced := map[string]bool{}
+	add := func(docFile string, blocks []markdown.Block) error {
+		for _, ref := range imageRefs(blocks) {
+			abs, err := filepath.Abs(filepath.Join(filepath.Dir(docFile), filepath.FromSlash(ref)))
+			if err != nil {
+				return err
+			}
+			referenced[abs] = true
+		}
+		return nil
+	}
+	if err := add(file, blocks); err != nil {
+		return nil, err
+	}
+
+	if keepUndo {
+		// Keep the images of earlier states, so Undo can restore them.
+		entries, err := readJournal(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			earlier, err := markdown.Parse(strings.NewReader(entry.Content))
+			if err != nil {
+				continue
+			}
+			if err := add(file, earlier); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	others, err := filepath.Glob(filepath.Join(filepath.Dir(file), "*.md"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(others)
+	self, _ := filepath.Abs(file)
+	for _, other := range others {
+		if abs, _ := filepath.Abs(other); abs == self || strings.HasPrefix(filepath.Base(other), ".") {
+			continue
+		}
+		otherBlocks, err := readBlocks(other)
+		if err != nil {
+			continue // not readable as a document; it cannot hold references
+		}
+		if err := add(other, otherBlocks); err != nil {
+			return nil, err
+		}
+	}
+	return referenced, nil
+}
+
+// sizeUnits are the suffixes accepted by parseSize, largest first.
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize parses a size such as "5MB", "500KB" or "1024". Units are
+// binary: 1KB is 1024 bytes.
+func parseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, u.suffix))
+			unit = u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// FormatSize formats a byte count using the largest unit that keeps the
+// number at least 1, for example "4.2MB".
+func FormatSize(n int64) string {
+	for _, u := range sizeUnits {
+		if n >= u.bytes && u.bytes > 1 {
+			return strconv.FormatFloat(float64(n)/float64(u.bytes), 'f', 1, 64) + u.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
+
+// ImageBudget returns the total size of the image files a document
+// references, counting each file once, and the image budget from its front
+// matter in bytes (0 when it has none). Missing files are not counted.
+func ImageBudget(file string) (total, budget int64, err error) {
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	if s := documentMetadata(blocks).ImageBudget; s != "" {
+		budget, err = parseSize(s)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, ref := range imageRefs(blocks) {
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		info, err := os.Stat(filepath.Join(filepath.Dir(file), filepath.FromSlash(ref)))
+		if err != nil {
+			continue
+		}
+		total += info.Size()
+	}
+	return total, budget, nil
+}
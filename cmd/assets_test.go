@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestImageAssetsDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := InitWithMetadata(file, "Test", "dev", markdown.Metadata{Assets: "images"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pngPath := filepath.Join(dir, "test.png")
+	if err := os.WriteFile(pngPath, minimalPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Image(file, pngPath, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := blocks[2].(markdown.ImageOutputBlock)
+	if !strings.HasPrefix(img.Filename, "images/") {
+		t.Fatalf("expected image under images/, got %q", img.Filename)
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(img.Filename))); err != nil {
+		t.Errorf("expected image in assets directory: %v", err)
+	}
+}
+
+func TestInitRejectsAssetsOutsideDocument(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	for _, assets := range []string{filepath.Join(dir, "images"), "..", "../..", "images/../../x"} {
+		err := InitWithMetadata(file, "Test", "dev", markdown.Metadata{Assets: assets})
+		if err == nil {
+			t.Errorf("expected error for assets directory %q", assets)
+		}
+	}
+	if err := InitWithMetadata(file, "Test", "dev", markdown.Metadata{Assets: "images/../img"}); err != nil {
+		t.Errorf("expected a path that stays inside to be accepted: %v", err)
+	}
+}
+
+func TestGCRejectsAssetsOutsideDocument(t *testing.T) {
+	// Front matter edited by hand is checked too.
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	doc := "---\nassets: ../..\n---\n\n# Test\n\n*2026-02-06T00:00:00Z*\n"
+	if err := os.WriteFile(file, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GC(file, GCOptions{}); err == nil || !strings.Contains(err.Error(), "inside the document's directory") {
+		t.Errorf("expected gc to reject the assets directory, got %v", err)
+	}
+}
+
+func TestGC(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	pngPath := filepath.Join(dir, "test.png")
+	if err := os.WriteFile(pngPath, minimalPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Image(file, pngPath, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Image(file, pngPath, ""); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := blocks[2].(markdown.ImageOutputBlock).Filename
+	popped := blocks[4].(markdown.ImageOutputBlock).Filename
+	if err := Pop(file); err != nil {
+		t.Fatal(err)
+	}
+	// Without a journal nothing can restore the popped image.
+	if err := os.Remove(journalPath(file)); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := GC(file, GCOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Removed) != 1 || filepath.Base(result.Removed[0]) != popped {
+		t.Fatalf("expected %s to be reported, got %v", popped, result.Removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, popped)); err != nil {
+		t.Error("dry run should not delete files")
+	}
+
+	if _, err := GC(file, GCOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, popped)); !os.IsNotExist(err) {
+		t.Error("expected unreferenced image to be deleted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, kept)); err != nil {
+		t.Error("expected referenced image to be kept")
+	}
+	if _, err := os.Stat(pngPath); err != nil {
+		t.Error("expected image without a generated name to be kept")
+	}
+}
+
+func TestGCKeepsImagesOfOtherDocuments(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.md")
+	second := filepath.Join(dir, "second.md")
+	for _, f := range []string{first, second} {
+		if err := Init(f, "Test", "dev"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pngPath := filepath.Join(dir, "test.png")
+	if err := os.WriteFile(pngPath, minimalPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Image(second, pngPath, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := GC(first, GCOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Removed) != 0 {
+		t.Errorf("expected other document's image to be kept, got %v", result.Removed)
+	}
+}
+
+func TestGCReportsMissing(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	pngPath := filepath.Join(dir, "test.png")
+	if err := os.WriteFile(pngPath, minimalPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Image(file, pngPath, ""); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := blocks[2].(markdown.ImageOutputBlock).Filename
+	if err := os.Remove(filepath.Join(dir, name)); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := GC(file, GCOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Missing) != 1 || result.Missing[0] != name {
+		t.Errorf("expected %s to be reported missing, got %v", name, result.Missing)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"1024", 1024},
+		{"5MB", 5 << 20},
+		{"500kb", 500 << 10},
+		{"1.5 GB", 3 << 29},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.input)
+		if err != nil {
+			t.Errorf("parseSize(%q): %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "MB", "-1KB", "five"} {
+		if _, err := parseSize(bad); err == nil {
+			t.Errorf("parseSize(%q): expected error", bad)
+		}
+	}
+}
+
+func TestImageBudget(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := InitWithMetadata(file, "Test", "dev", markdown.Metadata{ImageBudget: "100B"}); err != nil {
+		t.Fatal(err)
+	}
+	pngPath := filepath.Join(dir, "test.png")
+	if err := os.WriteFile(pngPath, minimalPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Image(file, pngPath, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Image(file, pngPath, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	total, budget, err := ImageBudget(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if budget != 100 {
+		t.Errorf("expected budget 100, got %d", budget)
+	}
+	if want := int64(2 * len(minimalPNG)); total != want {
+		t.Errorf("expected total %d, got %d", want, total)
+	}
+}
+
+func TestInitRejectsInvalidImageBudget(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.md")
+	if err := InitWithMetadata(file, "Test", "dev", markdown.Metadata{ImageBudget: "lots"}); err == nil {
+		t.Error("expected error for invalid image budget")
+	}
+}
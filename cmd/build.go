@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -12,6 +14,12 @@ import (
 
 // Note appends a commentary block to an existing showboat document.
 func Note(file, text string) error {
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	blocks, err := readBlocks(file)
 	if err != nil {
 		return err
@@ -34,22 +42,43 @@ func Note(file, text string) error {
 // Exec appends a code block, executes it, and appends the output.
 // It returns the captured output, the process exit code, and any error.
 func Exec(file, lang, code, workdir string) (string, int, error) {
+	return ExecBlock(file, markdown.CodeBlock{Lang: lang, Code: code}, workdir)
+}
+
+// ExecBlock is like Exec but takes a complete code block, so that attributes
+// such as Setup are recorded in the document.
+func ExecBlock(file string, codeBlock markdown.CodeBlock, workdir string) (string, int, error) {
 	if _, err := os.Stat(file); err != nil {
 		return "", 1, fmt.Errorf("file not found: %s", file)
 	}
+	if codeBlock.IsImage {
+		return "", 1, fmt.Errorf("image blocks cannot be executed with exec")
+	}
+	if err := codeBlock.Validate(); err != nil {
+		return "", 1, err
+	}
 
-	output, exitCode, err := execpkg.Run(lang, code, workdir)
+	output, exitCode, err := execpkg.Run(codeBlock.Lang, codeBlock.Code, workdir)
 	if err != nil {
 		return "", exitCode, fmt.Errorf("running code: %w", err)
 	}
+	recorded, err := recordedOutput(codeBlock.Match, output)
+	if err != nil {
+		return "", exitCode, err
+	}
+
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return "", exitCode, err
+	}
+	defer unlock()
 
 	blocks, err := readBlocks(file)
 	if err != nil {
 		return "", exitCode, err
 	}
 
-	codeBlock := markdown.CodeBlock{Lang: lang, Code: code}
-	outputBlock := markdown.OutputBlock{Content: output}
+	outputBlock := markdown.OutputBlock{Content: recorded}
 	blocks = append(blocks, codeBlock, outputBlock)
 
 	if err := writeBlocks(file, blocks); err != nil {
@@ -64,35 +93,155 @@ func Exec(file, lang, code, workdir string) (string, int, error) {
 	return output, exitCode, nil
 }
 
+// ImageOptions controls how Image adds an image to a document.
+type ImageOptions struct {
+	// Run treats the input as a bash script that creates an image and
+	// prints its path on the last line of output.
+	Run bool
+	// ContentHash names the image after a hash of its content. Documents
+	// with "image-names: hash" in their front matter always do this.
+	ContentHash bool
+	// MaxWidth, Quality and Strip resize, re-encode and strip metadata
+	// from the image as described by exec.CopyOptions.
+	MaxWidth int
+	Quality  int
+	Strip    bool
+	// Alt is the alt text for the image, overriding any alt text in a
+	// markdown image reference.
+	Alt string
+}
+
 // Image appends an image reference to a showboat document. The input is either
 // a plain path to an image file or a markdown image reference of the form
 // ![alt text](path). When a markdown reference is provided the alt text is
 // preserved; otherwise it is derived from the generated filename.
 func Image(file, input, workdir string) error {
+	return ImageWithOptions(file, input, workdir, ImageOptions{})
+}
+
+// ImageWithOptions is like Image but configurable with opts. With opts.Run
+// the input is a script run in workdir, and the image it reports is copied
+// into the document.
+func ImageWithOptions(file, input, workdir string, opts ImageOptions) error {
 	if _, err := os.Stat(file); err != nil {
 		return fmt.Errorf("file not found: %s", file)
 	}
 
-	imgPath, altText := parseImageInput(input)
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return err
+	}
+
+	// The image is stored before the document is locked, as ExecBlock runs
+	// its code, so that a slow image script does not hold up other commands.
+	destDir, prefix, err := assetDir(file, blocks)
+	if err != nil {
+		return err
+	}
+	copyOpts := opts.copyOptions(blocks)
+	var filename, altText string
+	if opts.Run {
+		filename, err = execpkg.RunImageWithOptions(input, destDir, workdir, copyOpts)
+	} else {
+		var imgPath string
+		imgPath, altText = parseImageInput(input)
+		filename, err = execpkg.CopyImageWithOptions(imgPath, destDir, copyOpts)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.Alt != "" {
+		altText = opts.Alt
+	}
+
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	blocks, err = readBlocks(file)
+	if err != nil {
+		return err
+	}
+
+	codeBlock := opts.codeBlock(input)
+	return appendImage(file, blocks, codeBlock, altText, destDir, prefix, filename)
+}
+
+// ImageData appends an image given as raw bytes, such as an image piped to
+// stdin, to a showboat document. The format is detected from the data. The
+// code block records the input as StdinImage.
+func ImageData(file string, data []byte, opts ImageOptions) error {
+	if _, err := os.Stat(file); err != nil {
+		return fmt.Errorf("file not found: %s", file)
+	}
+	if opts.Run {
+		return fmt.Errorf("image data cannot be run as a script")
+	}
 
-	destDir := filepath.Dir(file)
-	filename, err := execpkg.CopyImage(imgPath, destDir)
+	unlock, err := lockDocument(file)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
 	blocks, err := readBlocks(file)
 	if err != nil {
 		return err
 	}
 
+	destDir, prefix, err := assetDir(file, blocks)
+	if err != nil {
+		return err
+	}
+	filename, err := execpkg.SaveImage(data, destDir, opts.copyOptions(blocks))
+	if err != nil {
+		return err
+	}
+
+	codeBlock := opts.codeBlock(StdinImage)
+	return appendImage(file, blocks, codeBlock, opts.Alt, destDir, prefix, filename)
+}
+
+// StdinImage is the image input that reads raw image bytes from stdin.
+const StdinImage = "-"
+
+// codeBlock returns the image code block that records input and the
+// options used to store its image.
+func (opts ImageOptions) codeBlock(input string) markdown.CodeBlock {
+	return markdown.CodeBlock{
+		Lang: "bash", Code: input, IsImage: true, Run: opts.Run,
+		MaxWidth: opts.MaxWidth, Quality: opts.Quality, Strip: opts.Strip, Hash: opts.ContentHash,
+	}
+}
+
+// blockImageOptions returns the options recorded in the image code block
+// cb, for storing its image again.
+func blockImageOptions(cb markdown.CodeBlock) ImageOptions {
+	return ImageOptions{Run: cb.Run, ContentHash: cb.Hash, MaxWidth: cb.MaxWidth, Quality: cb.Quality, Strip: cb.Strip}
+}
+
+// copyOptions returns the exec options for storing an image in a document
+// with the given blocks.
+func (opts ImageOptions) copyOptions(blocks []markdown.Block) execpkg.CopyOptions {
+	copyOpts := imageCopyOptions(blocks)
+	copyOpts.ContentHash = copyOpts.ContentHash || opts.ContentHash
+	copyOpts.MaxWidth = opts.MaxWidth
+	copyOpts.Quality = opts.Quality
+	copyOpts.Strip = opts.Strip
+	return copyOpts
+}
+
+// appendImage appends an image code block and a reference to the image
+// stored as filename in destDir, then writes the document and posts the new
+// blocks to the remote. An empty altText is derived from the filename.
+func appendImage(file string, blocks []markdown.Block, codeBlock markdown.CodeBlock, altText, destDir, prefix, filename string) error {
 	if altText == "" {
-		// Derive alt text from the filename without UUID prefix and date
-		altText = strings.TrimSuffix(filename, filepath.Ext(filename))
+		altText = derivedAltText(filename)
 	}
 
-	codeBlock := markdown.CodeBlock{Lang: "bash", Code: input, IsImage: true}
-	imgBlock := markdown.ImageOutputBlock{AltText: altText, Filename: filename}
+	imgBlock := markdown.ImageOutputBlock{AltText: altText, Filename: path.Join(prefix, filename)}
 	blocks = append(blocks, codeBlock, imgBlock)
 
 	if err := writeBlocks(file, blocks); err != nil {
@@ -107,6 +256,13 @@ func Image(file, input, workdir string) error {
 	return nil
 }
 
+// derivedAltText returns the alt text given to an image stored as filename
+// when none is supplied: the file's name without its extension.
+func derivedAltText(filename string) string {
+	base := path.Base(filename)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
 // parseImageInput checks whether input is a markdown image reference
 // (![alt](path)) or a plain file path. It returns the image path and any
 // extracted alt text (empty when the input is a plain path).
@@ -146,13 +302,33 @@ func readBlocks(file string) ([]markdown.Block, error) {
 	return blocks, nil
 }
 
-// writeBlocks creates/truncates a file and writes blocks to it.
-func writeBlocks(file string, blocks []markdown.Block) error {
-	f, err := os.Create(file)
+// readSource reads a showboat document like readBlocks, also returning its
+// content and the source lines of each block.
+func readSource(file string) ([]byte, []markdown.Block, []markdown.Span, error) {
+	data, err := os.ReadFile(file)
 	if err != nil {
-		return fmt.Errorf("creating file: %w", err)
+		return nil, nil, nil, fmt.Errorf("opening file: %w", err)
 	}
-	defer f.Close()
+	blocks, spans, err := markdown.ParseSpans(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("parsing file: %w", err)
+	}
+	return data, blocks, spans, nil
+}
 
-	return markdown.Write(f, blocks)
+// writeBlocks replaces a file with blocks, atomically. The previous content
+// of an existing file is recorded in its journal for Undo. Callers changing
+// an existing document hold its lock (see lockDocument).
+func writeBlocks(file string, blocks []markdown.Block) error {
+	if err := recordJournal(file); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := markdown.Write(&buf, blocks); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(file, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("writing file: %w", err)
+	}
+	return nil
 }
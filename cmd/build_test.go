@@ -8,6 +8,9 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	execpkg "github.com/simonw/showboat/exec"
+	"github.com/simonw/showboat/markdown"
 )
 
 func TestNote(t *testing.T) {
@@ -362,3 +365,144 @@ func TestImageMarkdownRefBadPath(t *testing.T) {
 		t.Error("expected error for nonexistent image path in markdown ref")
 	}
 }
+
+func TestExecSetup(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	block := markdown.CodeBlock{Lang: "bash", Code: "echo prepared", Setup: true}
+	if _, _, err := ExecBlock(file, block, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(content)
+	if !strings.Contains(s, "<details>\n<summary>Setup</summary>\n\n```bash {setup}\necho prepared\n```\n\n```output\nprepared\n```\n\n</details>\n") {
+		t.Errorf("expected setup block wrapped in details, got: %s", s)
+	}
+
+	commands, err := Extract(file, "demo.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commands[1] != "showboat exec demo.md bash 'echo prepared' --setup" {
+		t.Errorf("expected setup exec command, got: %s", commands[1])
+	}
+}
+
+func TestImageRun(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	work := t.TempDir()
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(work, "source.png"), minimalPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	script := "cp source.png chart.png && echo chart.png"
+	if err := ImageWithOptions(file, script, work, ImageOptions{Run: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, ok := blocks[1].(markdown.CodeBlock)
+	if !ok || !code.IsImage || !code.Run || code.Code != script {
+		t.Fatalf("expected image run code block, got %+v", blocks[1])
+	}
+	img, ok := blocks[2].(markdown.ImageOutputBlock)
+	if !ok {
+		t.Fatalf("expected ImageOutputBlock, got %T", blocks[2])
+	}
+	if _, err := os.Stat(filepath.Join(dir, img.Filename)); err != nil {
+		t.Errorf("expected copied image next to document: %v", err)
+	}
+}
+
+func TestImageContentHashFromFrontMatter(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	meta := markdown.Metadata{ImageNames: markdown.ImageNamesHash}
+	if err := InitWithMetadata(file, "Test", "dev", meta); err != nil {
+		t.Fatal(err)
+	}
+
+	pngPath := filepath.Join(dir, "test.png")
+	if err := os.WriteFile(pngPath, minimalPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Image(file, pngPath, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Image(file, pngPath, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := blocks[2].(markdown.ImageOutputBlock)
+	second := blocks[4].(markdown.ImageOutputBlock)
+	if first.Filename != second.Filename {
+		t.Errorf("expected the same image to share a file, got %q and %q", first.Filename, second.Filename)
+	}
+	if first.Filename != execpkg.HashedImageName(minimalPNG, ".png") {
+		t.Errorf("expected content-addressed name, got %q", first.Filename)
+	}
+}
+
+func TestImageData(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ImageData(file, minimalPNG, ImageOptions{Alt: "Piped"}); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb := blocks[1].(markdown.CodeBlock)
+	if !cb.IsImage || cb.Code != StdinImage {
+		t.Errorf("expected stdin image block, got %+v", cb)
+	}
+	img := blocks[2].(markdown.ImageOutputBlock)
+	if img.AltText != "Piped" {
+		t.Errorf("expected alt text Piped, got %q", img.AltText)
+	}
+	if !strings.HasSuffix(img.Filename, ".png") {
+		t.Errorf("expected detected .png extension, got %q", img.Filename)
+	}
+	if _, err := os.Stat(filepath.Join(dir, img.Filename)); err != nil {
+		t.Errorf("expected stored image: %v", err)
+	}
+}
+
+func TestImageDataRejectsNonImage(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImageData(file, []byte("screenshot.png\n"), ImageOptions{}); err == nil {
+		t.Error("expected error for data that is not an image")
+	}
+}
@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+
+	execpkg "github.com/simonw/showboat/exec"
+	"github.com/simonw/showboat/markdown"
+)
+
+// NoteAfter inserts a commentary block into a showboat document after the
+// entry containing block index after. Indexes count from 0 for the title,
+// as in "verify" diffs; a code block and its output form one entry, so the
+// note never separates them. Insertions are not streamed to a remote viewer.
+func NoteAfter(file, text string, after int) error {
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return err
+	}
+	if err := checkBlockIndex(blocks, after); err != nil {
+		return err
+	}
+
+	at := after + 1
+	if _, ok := blocks[after].(markdown.CodeBlock); ok && at < len(blocks) && entrySize(blocks, at) == 2 {
+		at++
+	}
+
+	newBlock := markdown.CommentaryBlock{Text: text}
+	blocks = append(blocks[:at], append([]markdown.Block{newBlock}, blocks[at:]...)...)
+	return writeBlocks(file, blocks)
+}
+
+// ExecReplace runs codeBlock and replaces the code block at block index, and
+// its output, with it and the new output. It returns the captured output,
+// the process exit code, and any error. Replacements are not streamed to a
+// remote viewer.
+func ExecReplace(file string, codeBlock markdown.CodeBlock, workdir string, index int) (string, int, error) {
+	if codeBlock.IsImage {
+		return "", 1, fmt.Errorf("image blocks cannot be executed with exec")
+	}
+	if err := codeBlock.Validate(); err != nil {
+		return "", 1, err
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return "", 1, err
+	}
+	if _, err := execEntry(blocks, index); err != nil {
+		return "", 1, err
+	}
+
+	// The code runs before the document is locked, as in ExecBlock, so
+	// other commands are not held up by it.
+	output, exitCode, err := execpkg.Run(codeBlock.Lang, codeBlock.Code, workdir)
+	if err != nil {
+		return "", exitCode, fmt.Errorf("running code: %w", err)
+	}
+	recorded, err := recordedOutput(codeBlock.Match, output)
+	if err != nil {
+		return "", exitCode, err
+	}
+
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return "", exitCode, err
+	}
+	defer unlock()
+
+	blocks, err = readBlocks(file)
+	if err != nil {
+		return "", exitCode, err
+	}
+	codeIdx, err := execEntry(blocks, index)
+	if err != nil {
+		return "", exitCode, err
+	}
+
+	blocks[codeIdx] = codeBlock
+	blocks = setOutput(blocks, codeIdx, markdown.OutputBlock{Content: recorded})
+	if err := writeBlocks(file, blocks); err != nil {
+		return output, exitCode, err
+	}
+	return output, exitCode, nil
+}
+
+// execEntry returns the index of the code block of the entry containing
+// block index, which must be an exec entry rather than an image entry.
+func execEntry(blocks []markdown.Block, index int) (int, error) {
+	codeIdx, err := codeEntry(blocks, index)
+	if err != nil {
+		return 0, err
+	}
+	if blocks[codeIdx].(markdown.CodeBlock).IsImage {
+		return 0, fmt.Errorf("block %d is an image entry, not an exec entry", codeIdx)
+	}
+	return codeIdx, nil
+}
+
+// Rerun executes the code block at block index again and replaces only its
+// output, leaving every other byte of the document unchanged. Image scripts
+// added with "image --run" are run again and their image reference is
+// replaced. It returns the captured output (empty for images), the process
+// exit code, and any error. Reruns are not streamed to a remote viewer.
+func Rerun(file string, index int, workdir string) (string, int, error) {
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return "", 1, err
+	}
+	codeIdx, err := codeEntry(blocks, index)
+	if err != nil {
+		return "", 1, err
+	}
+	cb := blocks[codeIdx].(markdown.CodeBlock)
+
+	// The code runs before the document is locked, as in ExecBlock, so
+	// other commands are not held up by it.
+	var output markdown.Block
+	var text string
+	exitCode := 0
+	if cb.IsImage {
+		if !cb.Run {
+			return "", 1, fmt.Errorf("block %d is an image reference, not a script that can be run", codeIdx)
+		}
+		destDir, prefix, err := assetDir(file, blocks)
+		if err != nil {
+			return "", 1, err
+		}
+		filename, err := execpkg.RunImageWithOptions(cb.Code, destDir, workdir, blockImageOptions(cb).copyOptions(blocks))
+		if err != nil {
+			return "", 1, err
+		}
+		output = markdown.ImageOutputBlock{Filename: path.Join(prefix, filename)}
+	} else {
+		text, exitCode, err = execpkg.Run(cb.Lang, cb.Code, workdir)
+		if err != nil {
+			return "", exitCode, fmt.Errorf("running code: %w", err)
+		}
+		recorded, err := recordedOutput(cb.Match, text)
+		if err != nil {
+			return "", exitCode, err
+		}
+		output = markdown.OutputBlock{Content: recorded}
+	}
+
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return "", exitCode, err
+	}
+	defer unlock()
+
+	data, blocks, spans, err := readSource(file)
+	if err != nil {
+		return "", exitCode, err
+	}
+	codeIdx, err = codeEntry(blocks, index)
+	if err != nil {
+		return "", exitCode, err
+	}
+	if blocks[codeIdx] != markdown.Block(cb) {
+		return "", exitCode, fmt.Errorf("block %d changed while it was running", codeIdx)
+	}
+	if img, ok := output.(markdown.ImageOutputBlock); ok {
+		if old, ok := outputAt(blocks, codeIdx).(markdown.ImageOutputBlock); ok {
+			img.AltText = old.AltText
+		}
+		output = img
+	}
+	if err := replaceOutput(file, data, blocks, spans, codeIdx, output); err != nil {
+		return text, exitCode, err
+	}
+	return text, exitCode, nil
+}
+
+// replaceOutput writes the document at file, whose content is data, with the
+// output of the code block at codeIdx replaced by output, or output inserted
+// after the code block if it has none. Only the lines of the old output
+// change.
+func replaceOutput(file string, data []byte, blocks []markdown.Block, spans []markdown.Span, codeIdx int, output markdown.Block) error {
+	var buf bytes.Buffer
+	if err := markdown.Write(&buf, []markdown.Block{output}); err != nil {
+		return err
+	}
+	text := buf.Bytes()
+
+	var start, end int
+	if outputAt(blocks, codeIdx) != nil {
+		start, end = lineOffset(data, spans[codeIdx+1].Start), lineOffset(data, spans[codeIdx+1].End)
+	} else {
+		start = lineOffset(data, spans[codeIdx].End)
+		end = start
+		text = append([]byte("\n"), text...)
+	}
+	if start > 0 && data[start-1] != '\n' {
+		// The code block ends the file without a final newline.
+		text = append([]byte("\n"), text...)
+	}
+
+	updated := append(append(append([]byte{}, data[:start]...), text...), data[end:]...)
+	if err := recordJournal(file); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(file, updated, 0644); err != nil {
+		return fmt.Errorf("writing file: %w", err)
+	}
+	return nil
+}
+
+// lineOffset returns the byte offset in data at which 1-based line n
+// starts, or len(data) if data has fewer lines.
+func lineOffset(data []byte, n int) int {
+	offset := 0
+	for line := 1; line < n; line++ {
+		i := bytes.IndexByte(data[offset:], '\n')
+		if i == -1 {
+			return len(data)
+		}
+		offset += i + 1
+	}
+	return offset
+}
+
+// checkBlockIndex returns an error if index is not a block of the document.
+func checkBlockIndex(blocks []markdown.Block, index int) error {
+	if index < 0 || index >= len(blocks) {
+		return fmt.Errorf("block %d does not exist: document has blocks 0 to %d", index, len(blocks)-1)
+	}
+	return nil
+}
+
+// codeEntry returns the index of the code block of the entry containing
+// block index, which may be the code block or its output.
+func codeEntry(blocks []markdown.Block, index int) (int, error) {
+	if err := checkBlockIndex(blocks, index); err != nil {
+		return 0, err
+	}
+	if _, ok := blocks[index].(markdown.CodeBlock); ok {
+		return index, nil
+	}
+	if index > 0 && entrySize(blocks, index) == 2 {
+		if _, ok := blocks[index-1].(markdown.CodeBlock); ok {
+			return index - 1, nil
+		}
+	}
+	return 0, fmt.Errorf("block %d is a %s block, not a code block", index, blocks[index].Type())
+}
+
+// outputAt returns the output block following the code block at codeIdx,
+// or nil if it has none.
+func outputAt(blocks []markdown.Block, codeIdx int) markdown.Block {
+	if codeIdx+1 < len(blocks) && entrySize(blocks, codeIdx+1) == 2 {
+		return blocks[codeIdx+1]
+	}
+	return nil
+}
+
+// setOutput replaces the output of the code block at codeIdx with output,
+// inserting it if the code block has no output.
+func setOutput(blocks []markdown.Block, codeIdx int, output markdown.Block) []markdown.Block {
+	if outputAt(blocks, codeIdx) != nil {
+		blocks[codeIdx+1] = output
+		return blocks
+	}
+	at := codeIdx + 1
+	return append(blocks[:at], append([]markdown.Block{output}, blocks[at:]...)...)
+}
+
+// CodeBlockAt returns the code block of the entry containing block index
+// in a showboat document.
+func CodeBlockAt(file string, index int) (markdown.CodeBlock, error) {
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return markdown.CodeBlock{}, err
+	}
+	codeIdx, err := codeEntry(blocks, index)
+	if err != nil {
+		return markdown.CodeBlock{}, err
+	}
+	return blocks[codeIdx].(markdown.CodeBlock), nil
+}
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestNoteAfter(t *testing.T) {
+	file := buildEntries(t)
+
+	// Inserting after a code block keeps it with its output.
+	if err := NoteAfter(file, "explained", 2); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cb, ok := blocks[4].(markdown.CommentaryBlock); !ok || cb.Text != "explained" {
+		t.Fatalf("expected note after the output, got %#v", blocks[4])
+	}
+	if _, ok := blocks[3].(markdown.OutputBlock); !ok {
+		t.Errorf("expected output to stay with its code block, got %#v", blocks[3])
+	}
+
+	if err := NoteAfter(file, "nope", 9); err == nil {
+		t.Error("expected error for a block that does not exist")
+	}
+}
+
+func TestExecReplace(t *testing.T) {
+	file := buildEntries(t)
+	output, exitCode, err := ExecReplace(file, markdown.CodeBlock{Lang: "bash", Code: "echo replaced"}, "", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "replaced\n" || exitCode != 0 {
+		t.Errorf("unexpected result %q, %d", output, exitCode)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 5 {
+		t.Fatalf("expected 5 blocks, got %d", len(blocks))
+	}
+	if cb := blocks[2].(markdown.CodeBlock); cb.Code != "echo replaced" {
+		t.Errorf("expected replaced code, got %q", cb.Code)
+	}
+	if ob := blocks[3].(markdown.OutputBlock); ob.Content != "replaced\n" {
+		t.Errorf("expected replaced output, got %q", ob.Content)
+	}
+
+	if _, _, err := ExecReplace(file, markdown.CodeBlock{Lang: "bash", Code: "true"}, "", 1); err == nil {
+		t.Error("expected error replacing a note")
+	}
+}
+
+func TestRerunKeepsRestOfDocument(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	counter := filepath.Join(dir, "count")
+	meta := markdown.Metadata{Author: "Jane", Tags: []string{"demo"}}
+	if err := InitWithMetadata(file, "Test", "dev", meta); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecBlock(file, markdown.CodeBlock{Lang: "bash", Code: "echo setup", Setup: true}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Section(file, "Counting", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo x >> "+counter+" && wc -l < "+counter, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "Some *markdown* text."); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecBlock(file, markdown.CodeBlock{Lang: "bash", Code: "exit 2", ExpectExit: 2}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, _, err := Rerun(file, 4, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(output) != "2" {
+		t.Errorf("expected re-run output 2, got %q", output)
+	}
+	after, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Replace(string(before), "```output\n1\n```", "```output\n2\n```", 1)
+	if string(after) != want {
+		t.Errorf("expected only the output to change.\nexpected:\n%s\ngot:\n%s", want, after)
+	}
+}
+
+func TestRerunKeepsHandEditedBytes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.md")
+	doc := "---\ntags:\n  - a\n  - b\n---\n\n# Test\n\n*2026-02-06T00:00:00Z*\n\n\n\n##   Heading  \n\n" +
+		"```bash\necho new\n```\n\n```output\nold\n```\n\n\nAfter.\n\n```bash\necho added\n```"
+	if err := os.WriteFile(file, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := Rerun(file, 3, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Rerun(file, 5, ""); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(doc, "old\n", "new\n", 1) + "\n\n```output\nadded\n```\n"
+	if string(got) != want {
+		t.Errorf("expected:\n%q\ngot:\n%q", want, got)
+	}
+}
+
+func TestRerunExitCode(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecBlock(file, markdown.CodeBlock{Lang: "bash", Code: "exit 2", ExpectExit: 2}, ""); err != nil {
+		t.Fatal(err)
+	}
+	_, exitCode, err := Rerun(file, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exitCode != 2 {
+		t.Errorf("expected exit code 2, got %d", exitCode)
+	}
+	cb, err := CodeBlockAt(file, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cb.ExpectExit != 2 {
+		t.Errorf("expected recorded expectation, got %+v", cb)
+	}
+	if _, _, err := Rerun(file, 0, ""); err == nil {
+		t.Error("expected error re-running the title")
+	}
+}
+
+func TestEditRunsCodeWithoutLock(t *testing.T) {
+	// Code runs before the document is locked, so it runs even while
+	// another command holds the lock.
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	marker := filepath.Join(dir, "ran")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	code := "touch " + shellQuote(marker) + "; echo done"
+	if _, _, err := Exec(file, "bash", code, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, edit := range map[string]func() error{
+		"rerun": func() error { _, _, err := Rerun(file, 1, ""); return err },
+		"exec --replace": func() error {
+			_, _, err := ExecReplace(file, markdown.CodeBlock{Lang: "bash", Code: code}, "", 1)
+			return err
+		},
+	} {
+		os.Remove(marker)
+		unlock, err := lockDocument(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- edit() }()
+
+		ran := false
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if _, err := os.Stat(marker); err == nil {
+				ran = true
+				break
+			}
+		}
+		unlock()
+		if err := <-done; err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !ran {
+			t.Errorf("%s: code did not run while the document was locked", name)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ExportFile runs export on the showboat document at file and writes the
+// result to output. Nothing is written unless the export succeeds, and then
+// output is replaced atomically. Writing over the document itself is
+// rejected.
+func ExportFile(file, output string, export func(string, io.Writer) error) error {
+	if sameFile(file, output) {
+		return fmt.Errorf("output %s is the document being exported", output)
+	}
+	var buf bytes.Buffer
+	if err := export(file, &buf); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(output, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", output, err)
+	}
+	return nil
+}
+
+// sameFile reports whether paths a and b name the same existing file.
+func sameFile(a, b string) bool {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ia, ib)
+}
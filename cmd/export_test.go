@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	original, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "demo.json")
+	if err := ExportFile(file, output, ExportJSON); err != nil {
+		t.Fatal(err)
+	}
+	exported, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(exported), `"schema": "showboat-document"`) {
+		t.Errorf("unexpected export:\n%s", exported)
+	}
+
+	// A failed export leaves the previous output alone.
+	failing := func(file string, w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errors.New("export failed")
+	}
+	if err := ExportFile(file, output, failing); err == nil {
+		t.Error("expected the export error")
+	}
+	if after, _ := os.ReadFile(output); string(after) != string(exported) {
+		t.Errorf("failed export changed the output:\n%s", after)
+	}
+
+	// Exporting over the document is rejected, however it is named.
+	same := filepath.Join(dir, ".", "demo.md")
+	if err := ExportFile(file, same, ExportJSON); err == nil || !strings.Contains(err.Error(), "document being exported") {
+		t.Errorf("expected an error exporting over the document, got %v", err)
+	}
+	if after, _ := os.ReadFile(file); string(after) != string(original) {
+		t.Errorf("document was changed:\n%s", after)
+	}
+}
+
+func TestExportSection(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Sections", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"First", "Second"} {
+		if err := Section(file, title, 2); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Exec(file, "bash", "echo in "+title, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exporters := map[string]func(string, string, io.Writer) error{
+		"ipynb": ExportNotebookSection,
+		"html":  ExportHTMLSection,
+		"json":  ExportJSONSection,
+		"asciicast": func(file, section string, w io.Writer) error {
+			return ExportAsciicastWithOptions(file, w, AsciicastOptions{Section: section})
+		},
+	}
+	for format, export := range exporters {
+		var buf strings.Builder
+		if err := export(file, "second", &buf); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		out := buf.String()
+		if !strings.Contains(out, "Sections") || !strings.Contains(out, "in Second") || strings.Contains(out, "in First") {
+			t.Errorf("%s: expected only the title and the second section, got:\n%s", format, out)
+		}
+		if err := export(file, "missing", io.Discard); err == nil {
+			t.Errorf("%s: expected an error for a missing section", format)
+		}
+	}
+}
@@ -2,41 +2,111 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/simonw/showboat/markdown"
 )
 
 // Extract parses a showboat document and returns the sequence of CLI commands
-// that would recreate it. OutputBlock and ImageOutputBlock are skipped since
-// they are generated by running code blocks. If outputFile is non-empty it is
-// used as the filename in the emitted commands; otherwise the input file path
-// is used.
+// that would recreate it. Setup blocks are always included. OutputBlock and
+// ImageOutputBlock are skipped since they are generated by running code
+// blocks. If outputFile is non-empty it is used as the filename in the emitted
+// commands; otherwise the input file path is used.
 func Extract(file, outputFile string) ([]string, error) {
+	return ExtractSection(file, outputFile, "")
+}
+
+// ExtractSection is like Extract but only emits the commands for the blocks
+// in the named section, after the "init" command for the document and any
+// setup blocks ahead of the section. An empty section extracts the whole
+// document.
+func ExtractSection(file, outputFile, section string) ([]string, error) {
+	steps, err := ExtractSteps(file, outputFile, section)
+	if err != nil {
+		return nil, err
+	}
+	commands := make([]string, len(steps))
+	for i, step := range steps {
+		commands[i] = step.String()
+	}
+	return commands, nil
+}
+
+// Step is one showboat command that helps recreate a document: the command
+// name, such as "exec", and its arguments, including flags.
+type Step struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+// String returns the step as a shell command line.
+func (s Step) String() string {
+	return "showboat " + s.Command + shellArgs(s.Args)
+}
+
+// shellArgs returns args shell-quoted, each preceded by a space.
+func shellArgs(args []string) string {
+	var sb strings.Builder
+	for _, arg := range args {
+		sb.WriteString(" " + shellQuote(arg))
+	}
+	return sb.String()
+}
+
+// ExtractSteps is like ExtractSection but returns the commands as Steps.
+func ExtractSteps(file, outputFile, section string) ([]Step, error) {
 	blocks, err := readBlocks(file)
 	if err != nil {
 		return nil, err
 	}
 
+	start, end, err := sectionRange(blocks, section)
+	if err != nil {
+		return nil, err
+	}
+
 	target := file
 	if outputFile != "" {
 		target = outputFile
 	}
-	quotedTarget := shellQuote(target)
 
-	var commands []string
+	var steps []Step
 
-	for _, block := range blocks {
+	for i, block := range blocks {
+		if !inSection(blocks, i, start, end) {
+			continue
+		}
 		switch b := block.(type) {
 		case markdown.TitleBlock:
-			commands = append(commands, fmt.Sprintf("showboat init %s %s", quotedTarget, shellQuote(b.Title)))
+			warnExtraFrontMatter(b.Metadata)
+			args := append([]string{target, b.Title}, metadataFlags(b.Metadata)...)
+			steps = append(steps, Step{Command: "init", Args: args})
 		case markdown.CommentaryBlock:
-			commands = append(commands, fmt.Sprintf("showboat note %s %s", quotedTarget, shellQuote(b.Text)))
+			steps = append(steps, Step{Command: "note", Args: []string{target, b.Text}})
+		case markdown.HeadingBlock:
+			args := []string{target, b.Title}
+			if b.Level != 2 {
+				args = append(args, "--level", strconv.Itoa(b.Level))
+			}
+			steps = append(steps, Step{Command: "section", Args: args})
 		case markdown.CodeBlock:
 			if b.IsImage {
-				commands = append(commands, fmt.Sprintf("showboat image %s %s", quotedTarget, shellQuote(b.Code)))
+				input := b.Code
+				img, hasImage := imageOutputAt(blocks, i)
+				if input == StdinImage && hasImage {
+					// The piped bytes are gone; recreate from the stored copy.
+					input = fmt.Sprintf("![%s](%s)", img.AltText, img.Filename)
+				}
+				args := append([]string{target, input}, imageFlags(b)...)
+				if hasImage {
+					args = append(args, altFlag(b, input, img)...)
+				}
+				steps = append(steps, Step{Command: "image", Args: args})
 			} else {
-				commands = append(commands, fmt.Sprintf("showboat exec %s %s %s", quotedTarget, b.Lang, shellQuote(b.Code)))
+				args := append([]string{target, b.Lang, b.Code}, codeFlags(b)...)
+				steps = append(steps, Step{Command: "exec", Args: args})
 			}
 		case markdown.OutputBlock:
 			// Skip: generated by running code blocks
@@ -45,7 +115,115 @@ func Extract(file, outputFile string) ([]string, error) {
 		}
 	}
 
-	return commands, nil
+	return steps, nil
+}
+
+// metadataFlags returns the "showboat init" flags that recreate meta.
+// Unrecognized front matter entries cannot be expressed as flags and are
+// omitted; warnExtraFrontMatter reports them.
+func metadataFlags(meta markdown.Metadata) []string {
+	var flags []string
+	flag := func(name, value string) {
+		if value != "" {
+			flags = append(flags, "--"+name, value)
+		}
+	}
+	flag("author", meta.Author)
+	flag("agent", meta.Agent)
+	for _, tag := range meta.Tags {
+		flag("tag", tag)
+	}
+	flag("commit", meta.Commit)
+	flag("description", meta.Description)
+	flag("image-names", meta.ImageNames)
+	flag("assets", meta.Assets)
+	flag("image-budget", meta.ImageBudget)
+	for _, source := range meta.Sources {
+		flag("source", source)
+	}
+	return flags
+}
+
+// warnExtraFrontMatter warns on stderr that the unrecognized front matter
+// entries of meta, which "showboat init" has no flags for, are not
+// recreated.
+func warnExtraFrontMatter(meta markdown.Metadata) {
+	if meta.Extra == "" {
+		return
+	}
+	var keys []string
+	for _, line := range strings.Split(meta.Extra, "\n") {
+		if key, _, found := strings.Cut(line, ":"); found && !isIndented(line) {
+			keys = append(keys, strings.TrimSpace(key))
+		}
+	}
+	if len(keys) == 0 {
+		keys = []string{"(unparsed lines)"}
+	}
+	fmt.Fprintf(os.Stderr, "showboat: extract warning: front matter not recreated by init: %s\n", strings.Join(keys, ", "))
+}
+
+// isIndented reports whether line starts with whitespace or a list marker.
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "-")
+}
+
+// codeFlags returns the "showboat exec" flags that recreate the attributes
+// of b.
+func codeFlags(b markdown.CodeBlock) []string {
+	var flags []string
+	if b.Setup {
+		flags = append(flags, "--setup")
+	}
+	if b.ExpectExit != 0 {
+		flags = append(flags, "--expect-exit", strconv.Itoa(b.ExpectExit))
+	} else if b.ExpectFailure {
+		flags = append(flags, "--expect-failure")
+	}
+	if b.Match != "" && b.Match != markdown.MatchExact {
+		flags = append(flags, "--match", b.Match)
+	}
+	return flags
+}
+
+// imageFlags returns the "showboat image" flags that recreate the
+// attributes of the image code block b.
+func imageFlags(b markdown.CodeBlock) []string {
+	var flags []string
+	if b.Run {
+		flags = append(flags, "--run")
+	}
+	if b.MaxWidth != 0 {
+		flags = append(flags, "--max-width", strconv.Itoa(b.MaxWidth))
+	}
+	if b.Quality != 0 {
+		flags = append(flags, "--quality", strconv.Itoa(b.Quality))
+	}
+	if b.Strip {
+		flags = append(flags, "--strip")
+	}
+	if b.Hash {
+		flags = append(flags, "--hash")
+	}
+	return flags
+}
+
+// altFlag returns the --alt flag that recreates the alt text of img, the
+// image of the image code block b added from input, or nil if "showboat
+// image" would give it that alt text anyway: taken from a markdown image
+// reference in input, or derived from the image's filename.
+func altFlag(b markdown.CodeBlock, input string, img markdown.ImageOutputBlock) []string {
+	alt := ""
+	if !b.Run {
+		_, alt = parseImageInput(input)
+	}
+	if alt == "" {
+		alt = derivedAltText(img.Filename)
+	}
+	if img.AltText == alt {
+		return nil
+	}
+	return []string{"--alt", img.AltText}
 }
 
 // shellQuote wraps a string in single quotes if it contains spaces, special
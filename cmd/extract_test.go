@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"image/color"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/simonw/showboat/markdown"
 )
 
 func TestExtract(t *testing.T) {
@@ -88,3 +91,112 @@ func TestExtractShellQuote(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractIncludesMetadataFlags(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	meta := markdown.Metadata{Author: "Jane Doe", Tags: []string{"one", "two"}}
+	if err := InitWithMetadata(file, "Test", "dev", meta); err != nil {
+		t.Fatal(err)
+	}
+
+	commands, err := Extract(file, "demo.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "showboat init demo.md Test --author 'Jane Doe' --tag one --tag two"
+	if commands[0] != expected {
+		t.Errorf("expected %q, got %q", expected, commands[0])
+	}
+}
+
+func TestExtractStdinImage(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImageData(file, minimalPNG, ImageOptions{Alt: "Chart"}); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := blocks[2].(markdown.ImageOutputBlock).Filename
+
+	commands, err := Extract(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "showboat image " + shellQuote(file) + " " + shellQuote("![Chart]("+name+")")
+	if commands[1] != want {
+		t.Errorf("expected %q, got %q", want, commands[1])
+	}
+}
+
+func TestExtractImageStorageFlags(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "photo.png")
+	writePixelPNG(t, src, color.White)
+	opts := ImageOptions{MaxWidth: 800, Quality: 75, Strip: true, ContentHash: true}
+	if err := ImageWithOptions(file, src, "", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	commands, err := Extract(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "showboat image " + shellQuote(file) + " " + shellQuote(src) + " --max-width 800 --quality 75 --strip --hash"
+	if commands[1] != want {
+		t.Errorf("expected %q, got %q", want, commands[1])
+	}
+
+	script, err := ExtractScript(file, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script, " --max-width 800 --quality 75 --strip --hash\n") {
+		t.Errorf("expected image flags in script, got:\n%s", script)
+	}
+}
+
+func TestExtractImageAlt(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "photo.png")
+	writePixelPNG(t, src, color.White)
+	if err := ImageWithOptions(file, src, "", ImageOptions{Alt: "Chart"}); err != nil {
+		t.Fatal(err)
+	}
+	// Alt text from the markdown reference or the filename needs no flag.
+	if err := Image(file, "![Photo]("+src+")", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Image(file, src, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	commands, err := Extract(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"showboat image " + shellQuote(file) + " " + shellQuote(src) + " --alt Chart",
+		"showboat image " + shellQuote(file) + " " + shellQuote("![Photo]("+src+")"),
+		"showboat image " + shellQuote(file) + " " + shellQuote(src),
+	}
+	if strings.Join(commands[1:], "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(commands[1:], "\n"))
+	}
+}
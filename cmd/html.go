@@ -0,0 +1,341 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// htmlPage is the data rendered by htmlTemplate.
+type htmlPage struct {
+	Title      string
+	Timestamp  string
+	Version    string
+	DocumentID string
+	Meta       markdown.Metadata
+	Status     *VerifyStatus
+	Stale      bool
+	Entries    []htmlEntry
+}
+
+// htmlEntry is a rendered block, or a setup code block and its output.
+type htmlEntry struct {
+	Setup bool
+	Body  template.HTML
+}
+
+// ExportHTML writes a showboat document to w as a single self-contained HTML
+// page: code is syntax highlighted, images are embedded as data URIs and
+// setup blocks are collapsed. The header shows the title, timestamp, version
+// and document ID, and the result of the last "verify" when there is one.
+func ExportHTML(file string, w io.Writer) error {
+	return ExportHTMLSection(file, "", w)
+}
+
+// ExportHTMLSection is like ExportHTML but only exports the title and the
+// named section. An empty section exports the whole document.
+func ExportHTMLSection(file, section string, w io.Writer) error {
+	blocks, err := readSection(file, section)
+	if err != nil {
+		return err
+	}
+	page := htmlPage{}
+	if status, err := LastVerify(file); err != nil {
+		return err
+	} else if status != nil {
+		page.Status = status
+		page.Stale = status.Stale(file)
+	}
+
+	for i := 0; i < len(blocks); i++ {
+		var body strings.Builder
+		setup := false
+		switch b := blocks[i].(type) {
+		case markdown.TitleBlock:
+			page.Title = strings.Join(strings.Fields(b.Title), " ")
+			page.Timestamp = b.Timestamp
+			page.Version = b.Version
+			page.DocumentID = b.DocumentID
+			page.Meta = b.Metadata
+			continue
+		case markdown.CommentaryBlock:
+			body.WriteString(renderCommentary(b.Text))
+		case markdown.HeadingBlock:
+			level := b.Level
+			if level < 2 || level > 6 {
+				level = 2
+			}
+			fmt.Fprintf(&body, "<h%d>%s</h%d>\n", level, html.EscapeString(b.Title), level)
+		case markdown.CodeBlock:
+			setup = b.Setup
+			// The path an image was copied from is not worth showing, but
+			// the script that generated one is.
+			if !b.IsImage || b.Run {
+				fmt.Fprintf(&body, "<pre class=\"code\" data-lang=\"%s\"><code>%s</code></pre>\n",
+					html.EscapeString(b.Lang), highlight(b.Lang, b.Code))
+			}
+			if i+1 < len(blocks) {
+				switch out := blocks[i+1].(type) {
+				case markdown.OutputBlock:
+					body.WriteString(renderOutput(out))
+					i++
+				case markdown.ImageOutputBlock:
+					img, err := renderImage(file, out)
+					if err != nil {
+						return err
+					}
+					body.WriteString(img)
+					i++
+				}
+			}
+		case markdown.OutputBlock:
+			body.WriteString(renderOutput(b))
+		case markdown.ImageOutputBlock:
+			img, err := renderImage(file, b)
+			if err != nil {
+				return err
+			}
+			body.WriteString(img)
+		}
+		page.Entries = append(page.Entries, htmlEntry{Setup: setup, Body: template.HTML(body.String())})
+	}
+
+	return htmlTemplate.Execute(w, page)
+}
+
+// renderOutput renders captured output.
+func renderOutput(out markdown.OutputBlock) string {
+	if out.Content == "" {
+		return "<pre class=\"output empty\">(no output)</pre>\n"
+	}
+	return "<pre class=\"output\">" + html.EscapeString(strings.TrimSuffix(out.Content, "\n")) + "</pre>\n"
+}
+
+// renderImage renders an image reference with the image embedded as a data
+// URI.
+func renderImage(file string, img markdown.ImageOutputBlock) (string, error) {
+	path := filepath.Join(filepath.Dir(file), filepath.FromSlash(img.Filename))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading image: %w", err)
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	mime, ok := imageMIMETypes[ext]
+	if !ok {
+		return "", fmt.Errorf("unsupported image type: %s", ext)
+	}
+	src := "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data)
+	alt := html.EscapeString(img.AltText)
+	return fmt.Sprintf("<figure><img src=\"%s\" alt=\"%s\"><figcaption>%s</figcaption></figure>\n", src, alt, alt), nil
+}
+
+// Inline markdown recognized in commentary, applied to escaped text.
+var (
+	inlineCode   = regexp.MustCompile("`([^`]+)`")
+	inlineLink   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	inlineStrong = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	inlineEm     = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+)
+
+// renderCommentary renders commentary as HTML. Only the most common markdown
+// is understood: paragraphs, "- " lists, inline code, emphasis and links.
+// Anything else is shown as text.
+func renderCommentary(text string) string {
+	var sb strings.Builder
+	for _, para := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		lines := strings.Split(strings.TrimSpace(para), "\n")
+		isList := true
+		for _, line := range lines {
+			if !strings.HasPrefix(line, "- ") && !strings.HasPrefix(line, "* ") {
+				isList = false
+			}
+		}
+		if isList {
+			sb.WriteString("<ul>\n")
+			for _, line := range lines {
+				sb.WriteString("<li>" + renderInline(line[2:]) + "</li>\n")
+			}
+			sb.WriteString("</ul>\n")
+			continue
+		}
+		sb.WriteString("<p>" + renderInline(strings.Join(lines, "\n")) + "</p>\n")
+	}
+	return sb.String()
+}
+
+// renderInline renders inline markdown in s. Code spans are rendered first
+// and protected from the other rules.
+func renderInline(s string) string {
+	var spans []string
+	s = inlineCode.ReplaceAllStringFunc(s, func(m string) string {
+		spans = append(spans, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return fmt.Sprintf("\x00%d\x00", len(spans)-1)
+	})
+	s = html.EscapeString(s)
+	s = inlineLink.ReplaceAllStringFunc(s, func(m string) string {
+		parts := inlineLink.FindStringSubmatch(m)
+		href := html.UnescapeString(parts[2])
+		if lower := strings.ToLower(href); strings.HasPrefix(lower, "javascript:") || strings.HasPrefix(lower, "data:") {
+			return m
+		}
+		return "<a href=\"" + html.EscapeString(href) + "\">" + parts[1] + "</a>"
+	})
+	s = inlineStrong.ReplaceAllString(s, "<strong>$1</strong>")
+	s = inlineEm.ReplaceAllString(s, "<em>$1</em>")
+	for i, span := range spans {
+		s = strings.Replace(s, fmt.Sprintf("\x00%d\x00", i), span, 1)
+	}
+	return s
+}
+
+// highlightKeywords are the keywords highlighted for each language family.
+var highlightKeywords = map[string][]string{
+	"shell": {"if", "then", "else", "elif", "fi", "for", "while", "until", "do", "done", "case", "esac",
+		"in", "function", "return", "export", "local", "set", "echo", "cd", "exit"},
+	"python": {"def", "class", "return", "if", "elif", "else", "for", "while", "in", "import", "from",
+		"as", "with", "try", "except", "finally", "raise", "lambda", "yield", "pass", "break",
+		"continue", "and", "or", "not", "is", "None", "True", "False", "print", "async", "await"},
+	"c": {"func", "function", "var", "let", "const", "return", "if", "else", "for", "while", "switch",
+		"case", "break", "continue", "import", "package", "type", "struct", "class", "new", "true",
+		"false", "null", "nil", "def", "end", "do", "require", "puts", "int", "void", "fn", "use"},
+}
+
+// highlightFamily returns the keyword family and line comment prefix used to
+// highlight lang.
+func highlightFamily(lang string) (family, comment string) {
+	ext, comment := tangleFile(lang)
+	switch ext {
+	case ".sh", ".zsh":
+		return "shell", comment
+	case ".py":
+		return "python", comment
+	case ".sql", ".lua", ".hs", ".r":
+		return "", comment
+	}
+	return "c", comment
+}
+
+// highlight returns code as HTML with comments, strings, numbers and
+// keywords wrapped in spans. It is a simple tokenizer, not a parser: it only
+// aims to make code easier to read.
+func highlight(lang, code string) template.HTML {
+	family, comment := highlightFamily(lang)
+	keywords := map[string]bool{}
+	for _, k := range highlightKeywords[family] {
+		keywords[k] = true
+	}
+
+	var sb strings.Builder
+	span := func(class, text string) {
+		sb.WriteString("<span class=\"" + class + "\">" + html.EscapeString(text) + "</span>")
+	}
+	rs := []rune(code)
+	for i := 0; i < len(rs); {
+		c := rs[i]
+		switch {
+		case strings.HasPrefix(string(rs[i:min(len(rs), i+len(comment))]), comment) &&
+			(i == 0 || rs[i-1] == ' ' || rs[i-1] == '\t' || rs[i-1] == '\n'):
+			end := i
+			for end < len(rs) && rs[end] != '\n' {
+				end++
+			}
+			span("c", string(rs[i:end]))
+			i = end
+		case c == '"' || c == '\'' || c == '`':
+			end := i + 1
+			for end < len(rs) && rs[end] != c {
+				if rs[end] == '\\' && c != '\'' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(rs))
+			span("s", string(rs[i:end]))
+			i = end
+		case isWordRune(c):
+			end := i
+			for end < len(rs) && isWordRune(rs[end]) {
+				end++
+			}
+			word := string(rs[i:end])
+			switch {
+			case keywords[word]:
+				span("k", word)
+			case c >= '0' && c <= '9':
+				span("n", word)
+			default:
+				sb.WriteString(html.EscapeString(word))
+			}
+			i = end
+		default:
+			sb.WriteString(html.EscapeString(string(c)))
+			i++
+		}
+	}
+	return template.HTML(sb.String())
+}
+
+// isWordRune reports whether r can be part of an identifier or number.
+func isWordRune(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+var htmlTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; line-height: 1.5; max-width: 52em; margin: 2em auto; padding: 0 1em; color: #1f2328; }
+header { border-bottom: 1px solid #d0d7de; margin-bottom: 1.5em; }
+header dl { display: grid; grid-template-columns: max-content auto; gap: 0 1em; font-size: 0.9em; color: #59636e; }
+header dd { margin: 0; }
+.status { display: inline-block; padding: 0.1em 0.6em; border-radius: 1em; font-size: 0.85em; font-weight: 600; }
+.status.passed { background: #dafbe1; color: #1a7f37; }
+.status.failed { background: #ffebe9; color: #cf222e; }
+.status.unverified { background: #eaeef2; color: #59636e; }
+pre { padding: 0.8em 1em; border-radius: 6px; overflow-x: auto; font-size: 0.85em; }
+pre.code { background: #f6f8fa; border: 1px solid #d0d7de; }
+pre.output { background: #1f2328; color: #e6edf3; margin-top: -0.5em; }
+pre.output.empty { color: #8c959f; font-style: italic; }
+code { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; }
+p code { background: #eff1f3; padding: 0.1em 0.3em; border-radius: 4px; }
+.k { color: #cf222e; } .s { color: #0a3069; } .c { color: #6e7781; font-style: italic; } .n { color: #0550ae; }
+figure { margin: 1em 0; } figure img { max-width: 100%; } figure object { width: 100%; height: 30em; }
+figcaption { font-size: 0.85em; color: #59636e; }
+details { margin: 1em 0; } summary { cursor: pointer; color: #59636e; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<p>{{if .Status}}{{if .Status.Passed}}<span class="status passed">Verified</span>{{else}}<span class="status failed">Verify failed</span>{{end}}
+at {{.Status.Time}}{{if .Status.Section}}, section “{{.Status.Section}}”{{end}}{{if .Status.Failed}}, failing blocks {{range $i, $b := .Status.Failed}}{{if $i}}, {{end}}{{$b}}{{end}}{{end}}{{if .Stale}} (the document has changed since){{end}}
+{{else}}<span class="status unverified">Not verified</span>{{end}}</p>
+<dl>
+<dt>Created</dt><dd>{{.Timestamp}}{{if .Version}} by Showboat {{.Version}}{{end}}</dd>
+{{if .DocumentID}}<dt>Document ID</dt><dd>{{.DocumentID}}</dd>
+{{end}}{{with .Meta}}{{if .Author}}<dt>Author</dt><dd>{{.Author}}</dd>
+{{end}}{{if .Agent}}<dt>Agent</dt><dd>{{.Agent}}</dd>
+{{end}}{{if .Commit}}<dt>Commit</dt><dd>{{.Commit}}</dd>
+{{end}}{{if .Tags}}<dt>Tags</dt><dd>{{range $i, $t := .Tags}}{{if $i}}, {{end}}{{$t}}{{end}}</dd>
+{{end}}{{if .Description}}<dt>Description</dt><dd>{{.Description}}</dd>
+{{end}}{{end}}</dl>
+</header>
+<main>
+{{range .Entries}}{{if .Setup}}<details>
+<summary>Setup</summary>
+{{.Body}}</details>
+{{else}}{{.Body}}{{end}}{{end}}</main>
+</body>
+</html>
+`))
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"image/color"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestExportHTML(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "HTML <Demo>", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "Run `ls <dir>` and **look**."); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecBlock(file, markdown.CodeBlock{Lang: "bash", Code: "echo setup", Setup: true}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "python3", "# greet\nprint('a < b')", ""); err != nil {
+		t.Fatal(err)
+	}
+	writePixelPNG(t, filepath.Join(dir, "dot.png"), color.RGBA{B: 255, A: 255})
+	if err := Image(file, "![blue dot]("+filepath.Join(dir, "dot.png")+")", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportHTML(file, &buf); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, want := range []string{
+		"<h1>HTML &lt;Demo&gt;</h1>",
+		"Not verified",
+		"<p>Run <code>ls &lt;dir&gt;</code> and <strong>look</strong>.</p>",
+		"<details>\n<summary>Setup</summary>\n<pre class=\"code\" data-lang=\"bash\">",
+		`<span class="c"># greet</span>`,
+		`<span class="s">&#39;a &lt; b&#39;</span>`,
+		`<pre class="output">a &lt; b</pre>`,
+		`<img src="data:image/png;base64,`,
+		`alt="blue dot"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected page to contain %q", want)
+		}
+	}
+
+	if _, err := Verify(file, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := ExportHTML(file, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<span class="status passed">Verified</span>`) {
+		t.Error("expected the passing verify status in the header")
+	}
+}
+
+func TestRenderInlineLinks(t *testing.T) {
+	got := renderInline("[docs](https://example.com/?a=1&b=2) [bad](javascript:alert(1))")
+	want := `<a href="https://example.com/?a=1&amp;b=2">docs</a> [bad](javascript:alert(1))`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// blockTypes lists the Type() of every block, in the order Info reports
+// them.
+var blockTypes = []string{"title", "commentary", "heading", "code", "output", "output-image"}
+
+// DocumentInfo summarizes a showboat document, as reported by "info".
+type DocumentInfo struct {
+	File       string `json:"file"`
+	Title      string `json:"title"`
+	Timestamp  string `json:"timestamp"`
+	Version    string `json:"version,omitempty"`
+	DocumentID string `json:"id,omitempty"`
+	// Blocks counts the blocks of each type, keyed by Type().
+	Blocks map[string]int `json:"blocks"`
+	// Languages counts the code blocks in each language, not counting
+	// image blocks.
+	Languages map[string]int `json:"languages"`
+	// OutputBytes is the total size of the recorded text output.
+	OutputBytes int64       `json:"output_bytes"`
+	Images      []ImageInfo `json:"images"`
+	// Verify is the result of the most recent "verify", if any.
+	Verify *VerifyInfo `json:"verify,omitempty"`
+}
+
+// ImageInfo describes an image referenced by a document.
+type ImageInfo struct {
+	Filename string `json:"filename"`
+	AltText  string `json:"alt"`
+	Exists   bool   `json:"exists"`
+	Size     int64  `json:"size"`
+}
+
+// VerifyInfo is a recorded verify result and whether the document has
+// changed since.
+type VerifyInfo struct {
+	VerifyStatus
+	Stale bool `json:"stale"`
+}
+
+// Info reads a showboat document and summarizes it.
+func Info(file string) (*DocumentInfo, error) {
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &DocumentInfo{
+		File:      file,
+		Blocks:    map[string]int{},
+		Languages: map[string]int{},
+		Images:    []ImageInfo{},
+	}
+	for _, t := range blockTypes {
+		info.Blocks[t] = 0
+	}
+	for _, block := range blocks {
+		info.Blocks[block.Type()]++
+		switch b := block.(type) {
+		case markdown.TitleBlock:
+			info.Title = b.Title
+			info.Timestamp = b.Timestamp
+			info.Version = b.Version
+			info.DocumentID = b.DocumentID
+		case markdown.CodeBlock:
+			if !b.IsImage {
+				info.Languages[b.Lang]++
+			}
+		case markdown.OutputBlock:
+			info.OutputBytes += int64(len(b.Content))
+		case markdown.ImageOutputBlock:
+			img := ImageInfo{Filename: b.Filename, AltText: b.AltText}
+			path := filepath.Join(filepath.Dir(file), filepath.FromSlash(b.Filename))
+			if fi, err := os.Stat(path); err == nil {
+				img.Exists = true
+				img.Size = fi.Size()
+			}
+			info.Images = append(info.Images, img)
+		}
+	}
+
+	status, err := LastVerify(file)
+	if err != nil {
+		return nil, err
+	}
+	if status != nil {
+		info.Verify = &VerifyInfo{VerifyStatus: *status, Stale: status.Stale(file)}
+	}
+	return info, nil
+}
+
+// String returns the summary as aligned, human-readable lines.
+func (info *DocumentInfo) String() string {
+	var sb strings.Builder
+	field := func(name, value string) {
+		fmt.Fprintf(&sb, "%-12s %s\n", name+":", value)
+	}
+
+	field("File", info.File)
+	field("Title", strings.Join(strings.Fields(info.Title), " "))
+	created := info.Timestamp
+	if info.Version != "" {
+		created += " by Showboat " + info.Version
+	}
+	field("Created", created)
+	if info.DocumentID != "" {
+		field("Document ID", info.DocumentID)
+	}
+
+	var counts []string
+	for _, t := range blockTypes {
+		if n := info.Blocks[t]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, t))
+		}
+	}
+	field("Blocks", strings.Join(counts, ", "))
+
+	langs := make([]string, 0, len(info.Languages))
+	for lang := range info.Languages {
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if info.Languages[langs[i]] != info.Languages[langs[j]] {
+			return info.Languages[langs[i]] > info.Languages[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+	for i, lang := range langs {
+		langs[i] = fmt.Sprintf("%s (%d)", lang, info.Languages[lang])
+	}
+	if len(langs) == 0 {
+		langs = []string{"none"}
+	}
+	field("Languages", strings.Join(langs, ", "))
+	field("Output", FormatSize(info.OutputBytes))
+
+	var total int64
+	missing := 0
+	for _, img := range info.Images {
+		total += img.Size
+		if !img.Exists {
+			missing++
+		}
+	}
+	summary := fmt.Sprintf("%d (%s)", len(info.Images), FormatSize(total))
+	if missing > 0 {
+		summary = fmt.Sprintf("%d (%s, %d missing)", len(info.Images), FormatSize(total), missing)
+	}
+	field("Images", summary)
+	for _, img := range info.Images {
+		size := FormatSize(img.Size)
+		if !img.Exists {
+			size = "missing"
+		}
+		fmt.Fprintf(&sb, "  %s  %s\n", img.Filename, size)
+	}
+
+	verified := "never"
+	if v := info.Verify; v != nil {
+		verified = "passed"
+		if !v.Passed {
+			failed := make([]string, len(v.Failed))
+			for i, b := range v.Failed {
+				failed[i] = fmt.Sprint(b)
+			}
+			verified = "failed (blocks " + strings.Join(failed, ", ") + ")"
+		}
+		verified += " at " + v.Time
+		if v.Section != "" {
+			verified += " for section " + fmt.Sprintf("%q", v.Section)
+		}
+		if v.Stale {
+			verified += ", document changed since"
+		}
+	}
+	field("Verified", verified)
+	return sb.String()
+}
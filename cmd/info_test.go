@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"encoding/json"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Info", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "Notes."); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hello", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "python3", "print('hi')", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "true", ""); err != nil {
+		t.Fatal(err)
+	}
+	writePixelPNG(t, filepath.Join(dir, "dot.png"), color.RGBA{A: 255})
+	for range 2 {
+		if err := Image(file, filepath.Join(dir, "dot.png"), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Verify(file, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Info(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, info.Images[1].Filename)); err != nil {
+		t.Fatal(err)
+	}
+	info, err = Info(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Title != "Info" || info.Version != "dev" || info.DocumentID == "" {
+		t.Errorf("unexpected header: %+v", info)
+	}
+	wantBlocks := map[string]int{"title": 1, "commentary": 1, "heading": 0, "code": 5, "output": 3, "output-image": 2}
+	for k, v := range wantBlocks {
+		if info.Blocks[k] != v {
+			t.Errorf("expected %d %s blocks, got %d", v, k, info.Blocks[k])
+		}
+	}
+	if info.Languages["bash"] != 2 || info.Languages["python3"] != 1 || len(info.Languages) != 2 {
+		t.Errorf("unexpected languages: %v", info.Languages)
+	}
+	if info.OutputBytes != int64(len("hello\nhi\n")) {
+		t.Errorf("expected %d output bytes, got %d", len("hello\nhi\n"), info.OutputBytes)
+	}
+	if !info.Images[0].Exists || info.Images[0].Size == 0 || info.Images[1].Exists {
+		t.Errorf("unexpected images: %+v", info.Images)
+	}
+	if info.Verify == nil || !info.Verify.Passed || info.Verify.Stale {
+		t.Errorf("expected a fresh passing verify result, got %+v", info.Verify)
+	}
+
+	text := info.String()
+	for _, want := range []string{
+		"Title:       Info\n",
+		"Blocks:      1 title, 1 commentary, 5 code, 3 output, 2 output-image\n",
+		"Languages:   bash (2), python3 (1)\n",
+		", 1 missing)",
+		"  " + info.Images[1].Filename + "  missing\n",
+		"Verified:    passed at ",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in:\n%s", want, text)
+		}
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	verify := decoded["verify"].(map[string]any)
+	if verify["passed"] != true || verify["stale"] != false {
+		t.Errorf("unexpected verify JSON: %v", verify)
+	}
+}
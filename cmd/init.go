@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"time"
@@ -10,28 +11,68 @@ import (
 )
 
 // Init creates a new showboat document with a title and timestamp.
-// Returns an error if the file already exists.
+// Returns an error if the file already exists, even if another process
+// creates it at the same time.
 func Init(file, title, version string) error {
+	return InitWithMetadata(file, title, version, markdown.Metadata{})
+}
+
+// InitWithMetadata is like Init but also records meta as YAML front matter
+// at the top of the document.
+func InitWithMetadata(file, title, version string, meta markdown.Metadata) error {
 	if _, err := os.Stat(file); err == nil {
 		return fmt.Errorf("file already exists: %s", file)
 	}
+	if meta.Assets != "" {
+		if err := checkAssets(meta.Assets); err != nil {
+			return err
+		}
+	}
+	if meta.ImageBudget != "" {
+		if _, err := parseSize(meta.ImageBudget); err != nil {
+			return err
+		}
+	}
 
 	timestamp := time.Now().UTC().Format(time.RFC3339)
 	docID := uuid.New().String()
 	blocks := []markdown.Block{
-		markdown.TitleBlock{Title: title, Timestamp: timestamp, Version: version, DocumentID: docID},
+		markdown.TitleBlock{Title: title, Timestamp: timestamp, Version: version, DocumentID: docID, Metadata: meta},
 	}
 
-	f, err := os.Create(file)
-	if err != nil {
-		return fmt.Errorf("creating file: %w", err)
+	if err := createDocument(file, blocks); err != nil {
+		return err
 	}
-	defer f.Close()
 
-	if err := markdown.Write(f, blocks); err != nil {
+	postSection(docID, "init", blocks)
+	return nil
+}
+
+// createDocument writes blocks to a new document file. The name is reserved
+// by creating the file exclusively, so this fails if the file already
+// exists, even if another process creates it at the same time. The content
+// is then written with writeFileAtomic, so that the document appears
+// complete or empty, and a failed write removes it again.
+func createDocument(file string, blocks []markdown.Block) error {
+	var buf bytes.Buffer
+	if err := markdown.Write(&buf, blocks); err != nil {
 		return err
 	}
 
-	postSection(docID, "init", blocks)
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("file already exists: %s", file)
+	}
+	if err != nil {
+		return fmt.Errorf("creating file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(file)
+		return fmt.Errorf("creating file: %w", err)
+	}
+	if err := writeFileAtomic(file, buf.Bytes(), 0644); err != nil {
+		os.Remove(file)
+		return fmt.Errorf("creating file: %w", err)
+	}
 	return nil
 }
@@ -96,3 +96,67 @@ func TestInitErrorsIfExists(t *testing.T) {
 		t.Error("expected error when file exists")
 	}
 }
+
+func TestCreateDocumentKeepsExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	os.WriteFile(file, []byte("existing"), 0644)
+
+	blocks := []markdown.Block{markdown.TitleBlock{Title: "New", Timestamp: "2026-02-06T00:00:00Z"}}
+	if err := createDocument(file, blocks); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected already exists error, got %v", err)
+	}
+	content, _ := os.ReadFile(file)
+	if string(content) != "existing" {
+		t.Errorf("existing file was changed: %q", content)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected no temporary files to remain, got %v", entries)
+	}
+}
+
+func TestCreateDocumentLeavesOnlyTheDocument(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	blocks := []markdown.Block{markdown.TitleBlock{Title: "New", Timestamp: "2026-02-06T00:00:00Z"}}
+	if err := createDocument(file, blocks); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(file)
+	if !strings.HasPrefix(string(content), "# New\n") {
+		t.Errorf("unexpected content: %q", content)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected no temporary files to remain, got %v", entries)
+	}
+}
+
+func TestInitWithMetadata(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	meta := markdown.Metadata{Author: "Jane", Agent: "claude", Tags: []string{"cli", "demo"}, Commit: "abc123"}
+	if err := InitWithMetadata(file, "My Demo", "v0.3.0", meta); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), "---\nauthor: Jane\nagent: claude\ntags: [cli, demo]\ncommit: abc123\n---\n\n# My Demo\n") {
+		t.Errorf("expected front matter before title, got: %q", content)
+	}
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb := blocks[0].(markdown.TitleBlock)
+	if tb.Metadata.Agent != "claude" || len(tb.Metadata.Tags) != 2 {
+		t.Errorf("metadata did not round trip: %+v", tb.Metadata)
+	}
+}
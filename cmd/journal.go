@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// journalLimit is the number of earlier document states kept for Undo.
+const journalLimit = 20
+
+// journalEntry is a document state recorded before the document was changed.
+type journalEntry struct {
+	Time    string `json:"time"`
+	Content string `json:"content"`
+}
+
+// sidecarPath returns the path of a hidden file stored next to a document,
+// named .<document>.<name>. It is named after the file a symlinked document
+// points to.
+func sidecarPath(file, name string) string {
+	file = resolvePath(file)
+	return filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+"."+name)
+}
+
+// journalPath returns the path of the undo journal for a document.
+func journalPath(file string) string {
+	return sidecarPath(file, "journal")
+}
+
+// readJournal returns the journal entries for a document, oldest first. A
+// missing journal has no entries.
+func readJournal(file string) ([]journalEntry, error) {
+	data, err := os.ReadFile(journalPath(file))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+	var entries []journalEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing journal: %w", err)
+	}
+	return entries, nil
+}
+
+// writeJournal replaces the journal for a document, removing it when there
+// are no entries.
+func writeJournal(file string, entries []journalEntry) error {
+	if len(entries) == 0 {
+		if err := os.Remove(journalPath(file)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing journal: %w", err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(journalPath(file), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing journal: %w", err)
+	}
+	return nil
+}
+
+// recordJournal appends the current content of a document to its journal
+// so the change about to be made can be undone. Nothing is recorded when
+// the document does not exist yet.
+func recordJournal(file string) error {
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+	entries, err := readJournal(file)
+	if err != nil {
+		return err
+	}
+	entries = append(entries, journalEntry{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Content: string(content),
+	})
+	if len(entries) > journalLimit {
+		entries = entries[len(entries)-journalLimit:]
+	}
+	return writeJournal(file, entries)
+}
+
+// Undo restores a document to the state it was in before the most recent
+// change made by showboat. Up to 20 changes can be undone. Undo is not
+// streamed to a remote viewer.
+func Undo(file string) error {
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := readJournal(file)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("nothing to undo")
+	}
+
+	last := entries[len(entries)-1]
+	if err := writeFileAtomic(file, []byte(last.Content), 0644); err != nil {
+		return fmt.Errorf("writing file: %w", err)
+	}
+	return writeJournal(file, entries[:len(entries)-1])
+}
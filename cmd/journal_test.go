@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestUndo(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "first"); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Section(file, "Second", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := Pop(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := Pop(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// Undo the two pops.
+	if err := Undo(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := Undo(file); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("expected note and section to be restored, got %d blocks", len(blocks))
+	}
+
+	// Undo the section.
+	if err := Undo(file); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("expected document before the section:\n%s\ngot:\n%s", before, after)
+	}
+}
+
+func TestUndoNothing(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Undo(file); err == nil {
+		t.Error("expected error with nothing to undo")
+	}
+}
+
+func TestJournalLimit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < journalLimit+5; i++ {
+		if err := Note(file, "note"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := readJournal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != journalLimit {
+		t.Errorf("expected %d journal entries, got %d", journalLimit, len(entries))
+	}
+	if filepath.Base(journalPath(file)) != ".demo.md.journal" {
+		t.Errorf("unexpected journal path %s", journalPath(file))
+	}
+}
+
+func TestGCKeepUndo(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	pngPath := filepath.Join(dir, "test.png")
+	if err := os.WriteFile(pngPath, minimalPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Image(file, pngPath, ""); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := blocks[2].(markdown.ImageOutputBlock).Filename
+	if err := Pop(file); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := GC(file, GCOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Removed) != 1 {
+		t.Fatalf("expected the popped image to be collected, got %v", result.Removed)
+	}
+	result, err = GC(file, GCOptions{KeepUndo: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Removed) != 0 {
+		t.Fatalf("expected image needed by undo to be kept, got %v", result.Removed)
+	}
+	if err := Undo(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+		t.Errorf("expected restored image to exist: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// ExportJSON writes a showboat document to w in the versioned JSON schema
+// of markdown.MarshalDocument. Images are referenced by filename, not
+// embedded.
+func ExportJSON(file string, w io.Writer) error {
+	return ExportJSONSection(file, "", w)
+}
+
+// ExportJSONSection is like ExportJSON but only exports the title and the
+// named section. An empty section exports the whole document.
+func ExportJSONSection(file, section string, w io.Writer) error {
+	blocks, err := readSection(file, section)
+	if err != nil {
+		return err
+	}
+	data, err := markdown.MarshalDocument(blocks)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ImportJSON creates a showboat document at file from a JSON document
+// written by ExportJSON, or by another tool using the same schema. The
+// document is restored as it was, including its ID. Referenced images are
+// not copied: they are expected next to the new document.
+func ImportJSON(jsonFile, file string) error {
+	data, err := os.ReadFile(jsonFile)
+	if err != nil {
+		return fmt.Errorf("reading JSON document: %w", err)
+	}
+	blocks, err := markdown.UnmarshalDocument(data)
+	if err != nil {
+		return fmt.Errorf("parsing JSON document: %w", err)
+	}
+	if len(blocks) == 0 {
+		return fmt.Errorf("parsing JSON document: no blocks")
+	}
+	if _, ok := blocks[0].(markdown.TitleBlock); !ok {
+		return fmt.Errorf("parsing JSON document: the first block must be the title")
+	}
+	for i, b := range blocks[1:] {
+		if _, ok := b.(markdown.TitleBlock); ok {
+			return fmt.Errorf("parsing JSON document: block %d: only the first block can be a title", i+1)
+		}
+	}
+
+	return createDocument(file, blocks)
+}
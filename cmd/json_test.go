@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJSONExportImport(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "JSON", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "A note."); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hi", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonFile := filepath.Join(dir, "demo.json")
+	f, err := os.Create(jsonFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ExportJSON(file, f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	copyFile := filepath.Join(dir, "copy.md")
+	if err := ImportJSON(jsonFile, copyFile); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := os.ReadFile(file)
+	copied, _ := os.ReadFile(copyFile)
+	if string(copied) != string(original) {
+		t.Errorf("imported document differs:\n%s\nwant:\n%s", copied, original)
+	}
+
+	if err := ImportJSON(jsonFile, copyFile); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected an error importing over an existing file, got %v", err)
+	}
+
+	noTitle := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(noTitle, []byte(`{"schema":"showboat-document","version":1,"blocks":[{"type":"commentary","text":"x"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportJSON(noTitle, filepath.Join(dir, "bad.md")); err == nil || !strings.Contains(err.Error(), "title") {
+		t.Errorf("expected a missing title error, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockDocument takes the advisory lock that serializes showboat commands
+// changing the same document, waiting for any other holder to release it.
+// The lock is held in a .<document>.lock file next to the document. The
+// returned function releases it.
+func lockDocument(file string) (unlock func(), err error) {
+	if _, err := os.Stat(file); err != nil {
+		return nil, fmt.Errorf("file not found: %s", file)
+	}
+	unlock, err = acquireLock(sidecarPath(file, "lock"))
+	if err != nil {
+		return nil, fmt.Errorf("locking file: %w", err)
+	}
+	return unlock, nil
+}
+
+// writeFileAtomic replaces file with data by writing a temporary file in the
+// same directory and renaming it over file, so that readers see either the
+// old or the new content and a failed write leaves the old content intact.
+// An existing file keeps its permissions; a new one is created with perm.
+// When file is a symlink, the file it points to is replaced and the link is
+// kept.
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	file = resolvePath(file)
+	if info, err := os.Stat(file); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, file)
+}
+
+// resolvePath returns file with any symlinks resolved, so that a document
+// reached through a link is written in place and shares its lock and other
+// sidecar files with the document itself. A file that does not exist yet is
+// returned unchanged.
+func resolvePath(file string) string {
+	resolved, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return file
+	}
+	return resolved
+}
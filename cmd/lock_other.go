@@ -0,0 +1,35 @@
+//go:build !unix
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockTimeout is how long acquireLock waits for another process to release
+// the lock.
+const lockTimeout = 30 * time.Second
+
+// acquireLock takes the lock by creating the file at path exclusively, and
+// releases it by removing the file. It waits up to lockTimeout for another
+// holder to remove it.
+func acquireLock(path string) (func(), error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("document is locked by another showboat process (remove %s if it is stale)", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
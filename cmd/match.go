@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// matchOutput reports whether actual output satisfies the recorded expected
+// output under the given match mode. A regex is matched against the output
+// without its final newline, so that $ anchors the end of the last line. An
+// error is returned when the recorded output is not valid for the mode, such
+// as a malformed regular expression.
+func matchOutput(mode, expected, actual string) (bool, error) {
+	switch mode {
+	case "", markdown.MatchExact:
+		return expected == actual, nil
+	case markdown.MatchContains:
+		return strings.Contains(actual, strings.TrimSuffix(expected, "\n")), nil
+	case markdown.MatchRegex:
+		re, err := regexp.Compile(strings.TrimSuffix(expected, "\n"))
+		if err != nil {
+			return false, fmt.Errorf("invalid regex: %w", err)
+		}
+		return re.MatchString(strings.TrimSuffix(actual, "\n")), nil
+	case markdown.MatchJSON:
+		var want, got any
+		if err := json.Unmarshal([]byte(expected), &want); err != nil {
+			return false, fmt.Errorf("recorded output is not valid JSON: %w", err)
+		}
+		if err := json.Unmarshal([]byte(actual), &got); err != nil {
+			return false, nil
+		}
+		return reflect.DeepEqual(want, got), nil
+	case markdown.MatchLinesUnordered:
+		missing, extra := lineDifferences(expected, actual)
+		return len(missing) == 0 && len(extra) == 0, nil
+	}
+	return false, fmt.Errorf("unknown match mode: %s", mode)
+}
+
+// recordedOutput returns the output to record for a block with the given
+// match mode, so that "verify" passes while the output is unchanged. For
+// regex it is a pattern that matches exactly output, which can then be
+// edited down to the part that matters. An error is returned if output
+// cannot be recorded for the mode, because "verify" could never compare
+// against it.
+func recordedOutput(mode, output string) (string, error) {
+	switch mode {
+	case markdown.MatchJSON:
+		if !json.Valid([]byte(output)) {
+			return "", fmt.Errorf("output is not valid JSON, so it cannot be recorded with --match json")
+		}
+	case markdown.MatchRegex:
+		return "^" + regexp.QuoteMeta(strings.TrimSuffix(output, "\n")) + "$\n", nil
+	}
+	return output, nil
+}
+
+// lineDifferences compares two outputs as multisets of lines. It returns the
+// expected lines absent from actual and the actual lines absent from
+// expected, each sorted.
+func lineDifferences(expected, actual string) (missing, extra []string) {
+	counts := map[string]int{}
+	for _, line := range outputLines(expected) {
+		counts[line]++
+	}
+	for _, line := range outputLines(actual) {
+		if counts[line] > 0 {
+			counts[line]--
+		} else {
+			extra = append(extra, line)
+		}
+	}
+	for line, n := range counts {
+		for ; n > 0; n-- {
+			missing = append(missing, line)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
+
+// outputLines splits output into lines, ignoring the final newline.
+func outputLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// expectedLabel returns the label used for the recorded output in a diff
+// message for the given match mode.
+func expectedLabel(mode string) string {
+	switch mode {
+	case markdown.MatchContains:
+		return "expected to contain"
+	case markdown.MatchRegex:
+		return "expected to match"
+	case markdown.MatchJSON:
+		return "expected JSON equal to"
+	case markdown.MatchLinesUnordered:
+		return "expected lines (any order)"
+	}
+	return "expected"
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestMatchOutput(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected string
+		actual   string
+		want     bool
+	}{
+		{"", "hello\n", "hello\n", true},
+		{"exact", "hello\n", "hello!\n", false},
+		{"contains", "ready\n", "starting\nready\ndone\n", true},
+		{"contains", "failed\n", "starting\nready\n", false},
+		{"regex", `^took \d+ms$`, "took 42ms\n", true},
+		{"regex", `^v1\.0 \(build [0-9]+\)$` + "\n", "v1.0 (build 7)\n", true},
+		{"regex", `^took \d+ms$`, "took 42ms\nmore\n", false},
+		{"regex", `(?m)^took \d+ms$` + "\n", "took 42ms\n", true},
+		{"json", `{"a": 1, "b": [1, 2]}`, "{\"b\":[1,2],\"a\":1}\n", true},
+		{"json", `{"a": 1}`, `{"a": 2}`, false},
+		{"json", `{"a": 1}`, "not json", false},
+		{"lines-unordered", "a\nb\nc\n", "c\na\nb\n", true},
+		{"lines-unordered", "a\nb\n", "a\na\n", false},
+	}
+	for _, tt := range tests {
+		got, err := matchOutput(tt.mode, tt.expected, tt.actual)
+		if err != nil {
+			t.Errorf("matchOutput(%q, %q, %q): %v", tt.mode, tt.expected, tt.actual, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("matchOutput(%q, %q, %q) = %v, want %v", tt.mode, tt.expected, tt.actual, got, tt.want)
+		}
+	}
+}
+
+func TestMatchOutputInvalidRecorded(t *testing.T) {
+	if _, err := matchOutput("regex", "(unclosed\n", "x"); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+	if _, err := matchOutput("json", "{not json", "{}"); err == nil {
+		t.Error("expected error for invalid recorded JSON")
+	}
+}
+
+func TestVerifyMatchModes(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	block := markdown.CodeBlock{Lang: "bash", Code: `echo '{"b": 2, "a": 1}'`, Match: markdown.MatchJSON}
+	if _, _, err := ExecBlock(file, block, ""); err != nil {
+		t.Fatal(err)
+	}
+	block = markdown.CodeBlock{Lang: "bash", Code: "printf 'one\\ntwo\\n'", Match: markdown.MatchLinesUnordered}
+	if _, _, err := ExecBlock(file, block, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite the recorded outputs so they differ textually but still match.
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := strings.Replace(string(content), `{"b": 2, "a": 1}`, `{"a":1,"b":2}`, 1)
+	s = strings.Replace(s, "```output\none\ntwo\n```", "```output\ntwo\none\n```", 1)
+	if err := os.WriteFile(file, []byte(s), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(s, "```bash {match=json}") {
+		t.Errorf("expected match attribute in document, got: %s", s)
+	}
+
+	diffs, err := Verify(file, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected no diffs, got %v", diffs)
+	}
+
+	// A real difference produces a mode-aware message.
+	s = strings.Replace(s, "```output\ntwo\none\n```", "```output\ntwo\nthree\n```", 1)
+	if err := os.WriteFile(file, []byte(s), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err = Verify(file, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 {
+		t.Fatalf("expected 1 diff, got %d", len(diffs))
+	}
+	msg := diffs[0].String()
+	for _, want := range []string{"expected lines (any order):", `missing lines: ["three"]`, `extra lines:   ["one"]`} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in diff message, got:\n%s", want, msg)
+		}
+	}
+}
+
+func TestExecRegexRecordsLiteralPattern(t *testing.T) {
+	// Output recorded with --match regex is quoted, so metacharacters in
+	// it match themselves and it always compiles.
+	file := filepath.Join(t.TempDir(), "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"echo 'cost: $5 (approx) a+b'", "echo '[unclosed'", "printf 'no newline'"} {
+		block := markdown.CodeBlock{Lang: "bash", Code: code, Match: markdown.MatchRegex}
+		if _, _, err := ExecBlock(file, block, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ob := blocks[2].(markdown.OutputBlock); ob.Content != `^cost: \$5 \(approx\) a\+b$`+"\n" {
+		t.Errorf("unexpected recorded pattern %q", ob.Content)
+	}
+	diffs, err := Verify(file, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected no diffs, got %+v", diffs)
+	}
+}
+
+func TestVerifyOutputKeepsPattern(t *testing.T) {
+	// A hand-written pattern is not replaced by the actual output, which
+	// would not match itself as a regex.
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	outputFile := filepath.Join(dir, "updated.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	block := markdown.CodeBlock{Lang: "bash", Code: "echo 'v1.0 (build 7)'", Match: markdown.MatchRegex}
+	if _, _, err := ExecBlock(file, block, ""); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern := `^v2\.0 \(build [0-9]+\)$`
+	s := strings.Replace(string(content), "```output\n^v1\\.0 \\(build 7\\)$\n```", "```output\n"+pattern+"\n```", 1)
+	if s == string(content) {
+		t.Fatalf("expected a quoted pattern to replace, got:\n%s", content)
+	}
+	if err := os.WriteFile(file, []byte(s), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := Verify(file, outputFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || !diffs[0].Mismatch {
+		t.Fatalf("expected 1 mismatch, got %+v", diffs)
+	}
+	updated, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(updated) != s {
+		t.Errorf("expected the recorded pattern to be kept, got:\n%s", updated)
+	}
+}
+
+func TestMatchJSONRequiresJSON(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	block := markdown.CodeBlock{Lang: "bash", Code: "echo not json", Match: markdown.MatchJSON}
+	if _, _, err := ExecBlock(file, block, ""); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Errorf("expected exec to reject non-JSON output, got %v", err)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 {
+		t.Errorf("expected nothing to be recorded, got %+v", blocks)
+	}
+
+	// A hand-edited recording that is not JSON fails only its own block.
+	if _, _, err := Exec(file, "bash", "echo first", ""); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = append(doc, "\n```bash {match=json}\necho '{}'\n```\n\n```output\n{not json\n```\n"...)
+	if err := os.WriteFile(file, doc, 0644); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := Verify(file, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].BlockIndex != 3 || !strings.Contains(diffs[0].String(), "recorded output is not valid JSON") {
+		t.Errorf("expected a diff for block 3, got %+v", diffs)
+	}
+}
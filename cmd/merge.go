@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	execpkg "github.com/simonw/showboat/exec"
+	"github.com/simonw/showboat/markdown"
+)
+
+// MergeOptions controls how Merge combines documents.
+type MergeOptions struct {
+	// Title is the title of the combined document. Empty uses the title of
+	// the first document.
+	Title string
+	// Sections turns the title of each document into a section heading,
+	// moving the document's own sections one level down.
+	Sections bool
+}
+
+// Merge creates a new showboat document at output from the entries of files,
+// in order. The combined document has a single title with a new ID, the
+// front matter of the first document, and the IDs of the documents it was
+// made from in its "sources" front matter. Images are copied into the
+// combined document's assets location. Merge fails if output exists.
+func Merge(output string, files []string, version string, opts MergeOptions) error {
+	if len(files) == 0 {
+		return fmt.Errorf("no documents to merge")
+	}
+	var sources [][]markdown.Block
+	for _, file := range files {
+		blocks, err := readBlocks(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if len(blocks) == 0 {
+			return fmt.Errorf("%s: document is empty", file)
+		}
+		sources = append(sources, blocks)
+	}
+
+	first, _ := sources[0][0].(markdown.TitleBlock)
+	meta := first.Metadata
+	meta.Sources = nil
+	for _, blocks := range sources {
+		if id := documentID(blocks); id != "" && !slices.Contains(meta.Sources, id) {
+			meta.Sources = append(meta.Sources, id)
+		}
+	}
+	title := opts.Title
+	if title == "" {
+		title = first.Title
+	}
+	blocks := []markdown.Block{markdown.TitleBlock{
+		Title:      title,
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		Version:    version,
+		DocumentID: uuid.New().String(),
+		Metadata:   meta,
+	}}
+
+	if _, err := os.Stat(output); err == nil {
+		return fmt.Errorf("file already exists: %s", output)
+	}
+	// Images copied before a failure are left for "gc" to clean up.
+	destDir, prefix, err := assetDir(output, blocks)
+	if err != nil {
+		return err
+	}
+	copyOpts := imageCopyOptions(blocks)
+	for i, source := range sources {
+		for _, block := range source {
+			switch b := block.(type) {
+			case markdown.TitleBlock:
+				if opts.Sections {
+					blocks = append(blocks, markdown.HeadingBlock{Level: 2, Title: strings.Join(strings.Fields(b.Title), " ")})
+				}
+				continue
+			case markdown.HeadingBlock:
+				if opts.Sections {
+					b.Level = min(b.Level+1, 6)
+				}
+				block = b
+			case markdown.ImageOutputBlock:
+				img, err := rehomeImage(files[i], b, destDir, prefix, copyOpts)
+				if err != nil {
+					return fmt.Errorf("%s: %w", files[i], err)
+				}
+				block = img
+			}
+			blocks = append(blocks, block)
+		}
+	}
+
+	return createDocument(output, blocks)
+}
+
+// rehomeImage copies the image that img references from the document at
+// file into destDir, and returns a reference to the copy using prefix.
+func rehomeImage(file string, img markdown.ImageOutputBlock, destDir, prefix string, opts execpkg.CopyOptions) (markdown.ImageOutputBlock, error) {
+	src := filepath.Join(filepath.Dir(file), filepath.FromSlash(img.Filename))
+	if _, err := os.Stat(src); err != nil {
+		return img, fmt.Errorf("image not found: %s", img.Filename)
+	}
+	name, err := execpkg.CopyImageWithOptions(src, destDir, opts)
+	if err != nil {
+		return img, err
+	}
+	img.Filename = path.Join(prefix, name)
+	return img, nil
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "login.md")
+	b := filepath.Join(dir, "parts", "search.md")
+	if err := os.Mkdir(filepath.Dir(b), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitWithMetadata(a, "Login", "dev", markdown.Metadata{Author: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(a, "bash", "echo login", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(b, "Search", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Section(b, "Query", 2); err != nil {
+		t.Fatal(err)
+	}
+	writePixelPNG(t, filepath.Join(dir, "dot.png"), color.RGBA{G: 255, A: 255})
+	if err := Image(b, "![green dot]("+filepath.Join(dir, "dot.png")+")", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "combined.md")
+	if err := Merge(out, []string{a, b}, "dev", MergeOptions{Title: "All", Sections: true}); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aBlocks, _ := readBlocks(a)
+	bBlocks, _ := readBlocks(b)
+
+	title := blocks[0].(markdown.TitleBlock)
+	if title.Title != "All" || title.Metadata.Author != "alice" {
+		t.Errorf("unexpected title block: %+v", title)
+	}
+	if title.DocumentID == documentID(aBlocks) || title.DocumentID == "" {
+		t.Error("expected a new document ID")
+	}
+	if want := []string{documentID(aBlocks), documentID(bBlocks)}; !reflect.DeepEqual(title.Metadata.Sources, want) {
+		t.Errorf("expected sources %v, got %v", want, title.Metadata.Sources)
+	}
+
+	want := []markdown.Block{
+		markdown.HeadingBlock{Level: 2, Title: "Login"},
+		aBlocks[1], aBlocks[2],
+		markdown.HeadingBlock{Level: 2, Title: "Search"},
+		markdown.HeadingBlock{Level: 3, Title: "Query"},
+		bBlocks[2],
+	}
+	if !reflect.DeepEqual(blocks[1:len(blocks)-1], want) {
+		t.Errorf("unexpected blocks:\n got %+v\nwant %+v", blocks[1:len(blocks)-1], want)
+	}
+
+	// The image moves from parts/ to the combined document's directory.
+	img := blocks[len(blocks)-1].(markdown.ImageOutputBlock)
+	if img.AltText != "green dot" || strings.Contains(img.Filename, "/") {
+		t.Errorf("unexpected image reference: %+v", img)
+	}
+	if _, err := os.Stat(filepath.Join(dir, img.Filename)); err != nil {
+		t.Errorf("image not copied: %v", err)
+	}
+
+	if err := Merge(out, []string{a, b}, "dev", MergeOptions{}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected an error merging into an existing file, got %v", err)
+	}
+}
+
+func TestMergeMissingImage(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.md")
+	doc := "# A\n\n*2026-01-01T00:00:00Z*\n\n```bash {image}\ngone.png\n```\n\n![gone](gone.png)\n"
+	if err := os.WriteFile(a, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out.md")
+	if err := Merge(out, []string{a}, "dev", MergeOptions{}); err == nil || !strings.Contains(err.Error(), "image not found") {
+		t.Errorf("expected a missing image error, got %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Error("expected no output after a failed merge")
+	}
+}
@@ -0,0 +1,572 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	execpkg "github.com/simonw/showboat/exec"
+	"github.com/simonw/showboat/markdown"
+)
+
+// notebook is a Jupyter notebook in nbformat 4.5.
+type notebook struct {
+	Cells         []nbCell   `json:"cells"`
+	Metadata      nbMetadata `json:"metadata"`
+	NBFormat      int        `json:"nbformat"`
+	NBFormatMinor int        `json:"nbformat_minor"`
+}
+
+// nbMetadata is the notebook-level metadata. The showboat entry records the
+// title block so that import can restore it.
+type nbMetadata struct {
+	KernelSpec   *nbKernelSpec   `json:"kernelspec,omitempty"`
+	LanguageInfo *nbLanguageInfo `json:"language_info,omitempty"`
+	Showboat     *nbDocument     `json:"showboat,omitempty"`
+}
+
+type nbKernelSpec struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Language    string `json:"language"`
+}
+
+type nbLanguageInfo struct {
+	Name string `json:"name"`
+}
+
+// nbDocument records a document's title block in notebook metadata.
+type nbDocument struct {
+	Title       string   `json:"title"`
+	Timestamp   string   `json:"timestamp,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	DocumentID  string   `json:"id,omitempty"`
+	Author      string   `json:"author,omitempty"`
+	Agent       string   `json:"agent,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Commit      string   `json:"commit,omitempty"`
+	Description string   `json:"description,omitempty"`
+	ImageNames  string   `json:"image_names,omitempty"`
+	Assets      string   `json:"assets,omitempty"`
+	ImageBudget string   `json:"image_budget,omitempty"`
+	Sources     []string `json:"sources,omitempty"`
+	Extra       string   `json:"extra,omitempty"`
+}
+
+// nbCell is a notebook cell. Outputs and ExecutionCount are only written
+// for code cells.
+type nbCell struct {
+	ID             string         `json:"id,omitempty"`
+	CellType       string         `json:"cell_type"`
+	Metadata       nbCellMetadata `json:"metadata"`
+	Source         nbText         `json:"source"`
+	Outputs        []nbOutput     `json:"outputs,omitempty"`
+	ExecutionCount *int           `json:"execution_count,omitempty"`
+}
+
+// MarshalJSON writes the outputs and null execution count that nbformat
+// requires of every code cell.
+func (c nbCell) MarshalJSON() ([]byte, error) {
+	type plain nbCell
+	if c.CellType != "code" {
+		return json.Marshal(plain(c))
+	}
+	outputs := c.Outputs
+	if outputs == nil {
+		outputs = []nbOutput{}
+	}
+	return json.Marshal(struct {
+		plain
+		Outputs        []nbOutput `json:"outputs"`
+		ExecutionCount *int       `json:"execution_count"`
+	}{plain(c), outputs, c.ExecutionCount})
+}
+
+// nbCellMetadata is a cell's metadata. The showboat entry records the code
+// block attributes that have no notebook equivalent.
+type nbCellMetadata struct {
+	Showboat *nbBlock `json:"showboat,omitempty"`
+}
+
+// nbBlock records a block's showboat attributes in cell metadata.
+type nbBlock struct {
+	Type          string `json:"type,omitempty"`
+	Lang          string `json:"lang,omitempty"`
+	Image         bool   `json:"image,omitempty"`
+	Run           bool   `json:"run,omitempty"`
+	Setup         bool   `json:"setup,omitempty"`
+	ExpectExit    int    `json:"expect_exit,omitempty"`
+	ExpectFailure bool   `json:"expect_failure,omitempty"`
+	Match         string `json:"match,omitempty"`
+	MaxWidth      int    `json:"max_width,omitempty"`
+	Quality       int    `json:"quality,omitempty"`
+	Strip         bool   `json:"strip,omitempty"`
+	Hash          bool   `json:"hash,omitempty"`
+	Filename      string `json:"filename,omitempty"`
+}
+
+// nbOutput is a code cell output: a stream, or display data and execution
+// results keyed by MIME type.
+type nbOutput struct {
+	OutputType string            `json:"output_type"`
+	Name       string            `json:"name,omitempty"`
+	Text       *nbText           `json:"text,omitempty"`
+	Data       map[string]nbText `json:"data,omitempty"`
+	Metadata   *struct{}         `json:"metadata,omitempty"`
+	EName      string            `json:"ename,omitempty"`
+	EValue     string            `json:"evalue,omitempty"`
+	Traceback  []string          `json:"traceback,omitempty"`
+}
+
+// nbText is multi-line notebook text, which nbformat stores either as one
+// string or as a list of lines.
+type nbText string
+
+func (t nbText) MarshalJSON() ([]byte, error) {
+	lines := strings.SplitAfter(string(t), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if lines == nil {
+		lines = []string{}
+	}
+	return json.Marshal(lines)
+}
+
+func (t *nbText) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = nbText(s)
+		return nil
+	}
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return err
+	}
+	*t = nbText(strings.Join(lines, ""))
+	return nil
+}
+
+// imageMIMETypes maps image extensions to the MIME types used for them in
+// notebook display data.
+var imageMIMETypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".svg":  "image/svg+xml",
+	".webp": "image/webp",
+	".avif": "image/avif",
+	".bmp":  "image/bmp",
+}
+
+// ExportNotebook writes a showboat document to w as a Jupyter notebook
+// (nbformat 4.5). Commentary and headings become markdown cells, and each
+// code block becomes a code cell whose output is a stdout stream. Images
+// are embedded as display_data outputs. Attributes without a notebook
+// equivalent, such as expected exit codes, are kept in "showboat" cell
+// metadata so that ImportNotebook can restore them.
+func ExportNotebook(file string, w io.Writer) error {
+	return ExportNotebookSection(file, "", w)
+}
+
+// ExportNotebookSection is like ExportNotebook but only exports the title
+// and the named section. An empty section exports the whole document.
+func ExportNotebookSection(file, section string, w io.Writer) error {
+	blocks, err := readSection(file, section)
+	if err != nil {
+		return err
+	}
+
+	nb := notebook{Cells: []nbCell{}, NBFormat: 4, NBFormatMinor: 5}
+	langs := map[string]int{}
+	cellID := func() string { return fmt.Sprintf("showboat-%d", len(nb.Cells)) }
+
+	for i := 0; i < len(blocks); i++ {
+		switch b := blocks[i].(type) {
+		case markdown.TitleBlock:
+			m := b.Metadata
+			nb.Metadata.Showboat = &nbDocument{
+				Title: b.Title, Timestamp: b.Timestamp, Version: b.Version, DocumentID: b.DocumentID,
+				Author: m.Author, Agent: m.Agent, Tags: m.Tags, Commit: m.Commit, Description: m.Description,
+				ImageNames: m.ImageNames, Assets: m.Assets, ImageBudget: m.ImageBudget, Sources: m.Sources, Extra: m.Extra,
+			}
+			nb.Cells = append(nb.Cells, nbCell{
+				ID: cellID(), CellType: "markdown",
+				Metadata: nbCellMetadata{Showboat: &nbBlock{Type: "title"}},
+				Source:   nbText("# " + strings.Join(strings.Fields(b.Title), " ") + "\n\n*" + b.Timestamp + "*"),
+			})
+		case markdown.CommentaryBlock:
+			nb.Cells = append(nb.Cells, nbCell{ID: cellID(), CellType: "markdown", Source: nbText(b.Text)})
+		case markdown.HeadingBlock:
+			nb.Cells = append(nb.Cells, nbCell{
+				ID: cellID(), CellType: "markdown",
+				Source: nbText(strings.Repeat("#", b.Level) + " " + b.Title),
+			})
+		case markdown.CodeBlock:
+			meta := &nbBlock{
+				Lang: b.Lang, Image: b.IsImage, Run: b.Run, Setup: b.Setup,
+				ExpectExit: b.ExpectExit, ExpectFailure: b.ExpectFailure, Match: b.Match,
+				MaxWidth: b.MaxWidth, Quality: b.Quality, Strip: b.Strip, Hash: b.Hash,
+			}
+			cell := nbCell{ID: cellID(), CellType: "code", Metadata: nbCellMetadata{Showboat: meta}, Source: nbText(b.Code)}
+			if !b.IsImage {
+				langs[b.Lang]++
+			}
+			if i+1 < len(blocks) {
+				switch out := blocks[i+1].(type) {
+				case markdown.OutputBlock:
+					if out.Content != "" {
+						text := nbText(out.Content)
+						cell.Outputs = []nbOutput{{OutputType: "stream", Name: "stdout", Text: &text}}
+					}
+					i++
+				case markdown.ImageOutputBlock:
+					output, err := imageOutput(file, out)
+					if err != nil {
+						return err
+					}
+					meta.Filename = out.Filename
+					cell.Outputs = []nbOutput{output}
+					i++
+				}
+			}
+			nb.Cells = append(nb.Cells, cell)
+		case markdown.ImageOutputBlock:
+			// An image reference without its code block.
+			output, err := imageOutput(file, b)
+			if err != nil {
+				return err
+			}
+			nb.Cells = append(nb.Cells, nbCell{
+				ID: cellID(), CellType: "code",
+				Metadata: nbCellMetadata{Showboat: &nbBlock{Image: true, Filename: b.Filename}},
+				Outputs:  []nbOutput{output},
+			})
+		case markdown.OutputBlock:
+			text := nbText(b.Content)
+			nb.Cells = append(nb.Cells, nbCell{
+				ID: cellID(), CellType: "code",
+				Outputs: []nbOutput{{OutputType: "stream", Name: "stdout", Text: &text}},
+			})
+		}
+	}
+
+	if lang := mostUsed(langs); lang != "" {
+		nb.Metadata.KernelSpec = &nbKernelSpec{Name: lang, DisplayName: lang, Language: lang}
+		nb.Metadata.LanguageInfo = &nbLanguageInfo{Name: lang}
+	}
+
+	data, err := json.MarshalIndent(nb, "", " ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// mostUsed returns the key with the highest count, preferring the
+// alphabetically first on ties, or "" for an empty map.
+func mostUsed(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	best := ""
+	for _, k := range keys {
+		if best == "" || counts[k] > counts[best] {
+			best = k
+		}
+	}
+	return best
+}
+
+// imageOutput returns a display_data output embedding the image that img
+// references.
+func imageOutput(file string, img markdown.ImageOutputBlock) (nbOutput, error) {
+	path := filepath.Join(filepath.Dir(file), filepath.FromSlash(img.Filename))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nbOutput{}, fmt.Errorf("reading image: %w", err)
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	mime, ok := imageMIMETypes[ext]
+	if !ok {
+		return nbOutput{}, fmt.Errorf("unsupported image type: %s", ext)
+	}
+	content := nbText(base64.StdEncoding.EncodeToString(data))
+	if ext == ".svg" {
+		content = nbText(data)
+	}
+	return nbOutput{
+		OutputType: "display_data",
+		Data:       map[string]nbText{mime: content, "text/plain": nbText(img.AltText)},
+		Metadata:   &struct{}{},
+	}, nil
+}
+
+// ImportNotebook creates a showboat document at file from a Jupyter notebook.
+// Markdown cells become commentary, or section headings when they hold a
+// single heading line; fenced code in them is kept as ~~~ fences, so that
+// it never becomes a code block that "verify" or "extract" would run. Code
+// cells become code blocks with their recorded output; images in display
+// data are stored as image entries. Recorded outputs are kept, so "verify"
+// can check them. Notebooks exported by showboat are restored with their
+// title, front matter and code block attributes.
+func ImportNotebook(notebookFile, file, version string) error {
+	data, err := os.ReadFile(notebookFile)
+	if err != nil {
+		return fmt.Errorf("reading notebook: %w", err)
+	}
+	var nb notebook
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return fmt.Errorf("parsing notebook: %w", err)
+	}
+	if nb.NBFormat != 4 {
+		return fmt.Errorf("unsupported notebook format %d (expected 4)", nb.NBFormat)
+	}
+
+	title := markdown.TitleBlock{
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		Version:    version,
+		DocumentID: uuid.New().String(),
+	}
+	if doc := nb.Metadata.Showboat; doc != nil {
+		title.Title = doc.Title
+		title.Metadata = markdown.Metadata{
+			Author: doc.Author, Agent: doc.Agent, Tags: doc.Tags, Commit: doc.Commit, Description: doc.Description,
+			ImageNames: doc.ImageNames, Assets: doc.Assets, ImageBudget: doc.ImageBudget, Sources: doc.Sources, Extra: doc.Extra,
+		}
+	}
+	defaultLang := "python3"
+	if nb.Metadata.LanguageInfo != nil && nb.Metadata.LanguageInfo.Name != "" {
+		defaultLang = interpreterFor(nb.Metadata.LanguageInfo.Name)
+	}
+
+	blocks := []markdown.Block{title}
+	var images []pendingImage
+	for _, cell := range nb.Cells {
+		meta := cell.Metadata.Showboat
+		if meta == nil {
+			meta = &nbBlock{}
+		}
+		source := strings.TrimRight(string(cell.Source), "\n")
+		switch cell.CellType {
+		case "markdown", "raw":
+			if meta.Type == "title" {
+				continue
+			}
+			if title.Title == "" && len(blocks) == 1 && strings.HasPrefix(source, "# ") && !strings.Contains(source, "\n") {
+				title.Title = strings.TrimPrefix(source, "# ")
+				continue
+			}
+			if h, ok := headingCell(source); ok {
+				blocks = append(blocks, h)
+			} else if source != "" {
+				blocks = append(blocks, markdown.CommentaryBlock{Text: escapeFences(source)})
+			}
+		case "code":
+			lang := meta.Lang
+			if lang == "" {
+				lang = defaultLang
+			}
+			text, imgs, err := cellOutputs(cell.Outputs)
+			if err != nil {
+				return err
+			}
+			if meta.Image {
+				cb := markdown.CodeBlock{
+					Lang: lang, Code: source, IsImage: true, Run: meta.Run,
+					MaxWidth: meta.MaxWidth, Quality: meta.Quality, Strip: meta.Strip, Hash: meta.Hash,
+				}
+				if cb.Code == "" {
+					cb.Code = StdinImage
+				}
+				if len(imgs) > 0 {
+					blocks = append(blocks, cb, markdown.ImageOutputBlock{})
+					images = append(images, pendingImage{index: len(blocks) - 1, image: imgs[0]})
+				}
+				continue
+			}
+			if source != "" || text != "" {
+				blocks = append(blocks, markdown.CodeBlock{
+					Lang: lang, Code: source, Setup: meta.Setup,
+					ExpectExit: meta.ExpectExit, ExpectFailure: meta.ExpectFailure, Match: meta.Match,
+				}, markdown.OutputBlock{Content: text})
+			}
+			for _, img := range imgs {
+				blocks = append(blocks, markdown.CodeBlock{Lang: "bash", Code: StdinImage, IsImage: true}, markdown.ImageOutputBlock{})
+				images = append(images, pendingImage{index: len(blocks) - 1, image: img})
+			}
+		}
+	}
+	if title.Title == "" {
+		title.Title = strings.TrimSuffix(filepath.Base(notebookFile), filepath.Ext(notebookFile))
+	}
+	blocks[0] = title
+	for _, block := range blocks {
+		if cb, ok := block.(markdown.CodeBlock); ok {
+			if err := cb.Validate(); err != nil {
+				return fmt.Errorf("invalid showboat cell metadata: %w", err)
+			}
+		}
+	}
+
+	if _, err := os.Stat(file); err == nil {
+		return fmt.Errorf("file already exists: %s", file)
+	}
+	// Images saved before a failure are left for "gc" to clean up.
+	if err := storeNotebookImages(file, blocks, images); err != nil {
+		return err
+	}
+	return createDocument(file, blocks)
+}
+
+// storeNotebookImages saves each pending image into the document's assets
+// directory, with the options recorded on its code block, and fills in its
+// image reference.
+func storeNotebookImages(file string, blocks []markdown.Block, images []pendingImage) error {
+	if len(images) == 0 {
+		return nil
+	}
+	destDir, prefix, err := assetDir(file, blocks)
+	if err != nil {
+		return err
+	}
+	for _, p := range images {
+		cb := blocks[p.index-1].(markdown.CodeBlock)
+		name, err := execpkg.SaveImage(p.image.data, destDir, blockImageOptions(cb).copyOptions(blocks))
+		if err != nil {
+			return fmt.Errorf("saving notebook image: %w", err)
+		}
+		alt := p.image.alt
+		if alt == "" {
+			alt = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		blocks[p.index] = markdown.ImageOutputBlock{AltText: alt, Filename: path.Join(prefix, name)}
+	}
+	return nil
+}
+
+// pendingImage is a notebook image waiting to be stored for the image
+// reference at block index.
+type pendingImage struct {
+	index int
+	image nbImage
+}
+
+// nbImage is an image decoded from notebook display data.
+type nbImage struct {
+	data []byte
+	alt  string
+}
+
+// cellOutputs returns the text of a code cell's outputs, concatenated in
+// order, and the images among them.
+func cellOutputs(outputs []nbOutput) (string, []nbImage, error) {
+	var sb strings.Builder
+	var images []nbImage
+	for _, out := range outputs {
+		switch out.OutputType {
+		case "stream":
+			if out.Text != nil {
+				sb.WriteString(string(*out.Text))
+			}
+		case "error":
+			sb.WriteString(out.EName + ": " + out.EValue + "\n")
+		case "display_data", "execute_result":
+			img, ok, err := displayImage(out.Data)
+			if err != nil {
+				return "", nil, err
+			}
+			if ok {
+				images = append(images, img)
+				continue
+			}
+			if text, ok := out.Data["text/plain"]; ok {
+				sb.WriteString(string(text))
+				if !strings.HasSuffix(string(text), "\n") {
+					sb.WriteString("\n")
+				}
+			}
+		}
+	}
+	return sb.String(), images, nil
+}
+
+// displayImage returns the image in notebook display data, if there is one.
+func displayImage(data map[string]nbText) (nbImage, bool, error) {
+	mimes := make([]string, 0, len(imageMIMETypes))
+	for _, mime := range imageMIMETypes {
+		mimes = append(mimes, mime)
+	}
+	sort.Strings(mimes)
+	for _, mime := range mimes {
+		content, ok := data[mime]
+		if !ok {
+			continue
+		}
+		img := nbImage{alt: strings.TrimSpace(string(data["text/plain"]))}
+		if mime == "image/svg+xml" {
+			img.data = []byte(content)
+			return img, true, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(content)), ""))
+		if err != nil {
+			return nbImage{}, false, fmt.Errorf("decoding %s output: %w", mime, err)
+		}
+		img.data = decoded
+		return img, true, nil
+	}
+	return nbImage{}, false, nil
+}
+
+// headingCell returns the heading block for a markdown cell holding a single
+// "##" to "######" heading line.
+func headingCell(source string) (markdown.HeadingBlock, bool) {
+	if strings.Contains(source, "\n") {
+		return markdown.HeadingBlock{}, false
+	}
+	level := len(source) - len(strings.TrimLeft(source, "#"))
+	if level < 2 || level > 6 || !strings.HasPrefix(source[level:], " ") {
+		return markdown.HeadingBlock{}, false
+	}
+	title := strings.TrimSpace(source[level:])
+	if title == "" {
+		return markdown.HeadingBlock{}, false
+	}
+	return markdown.HeadingBlock{Level: level, Title: title}, true
+}
+
+// escapeFences replaces the backticks that open each ``` line of text with as
+// many tildes. Markdown renders ~~~ fences the same way, but showboat only
+// reads ``` fences as code blocks.
+func escapeFences(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "```") {
+			ticks := len(line) - len(strings.TrimLeft(line, "`"))
+			lines[i] = strings.Repeat("~", ticks) + line[ticks:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// interpreterFor returns the interpreter showboat runs for a notebook
+// language. Notebooks name the language "python", but showboat runs code
+// with the named interpreter, which is usually installed as python3.
+func interpreterFor(lang string) string {
+	if strings.EqualFold(lang, "python") {
+		return "python3"
+	}
+	return strings.ToLower(lang)
+}
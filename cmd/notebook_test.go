@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestNotebookRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := InitWithMetadata(file, "Round Trip", "dev", markdown.Metadata{Author: "alice", Tags: []string{"a", "b"}, ImageNames: "hash"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "Some *commentary*."); err != nil {
+		t.Fatal(err)
+	}
+	if err := Section(file, "Part", 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hello", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecBlock(file, markdown.CodeBlock{Lang: "bash", Code: "exit 3", ExpectExit: 3}, ""); err != nil {
+		t.Fatal(err)
+	}
+	writePixelPNG(t, filepath.Join(dir, "dot.png"), color.RGBA{R: 255, A: 255})
+	if err := Image(file, "![a red dot]("+filepath.Join(dir, "dot.png")+")", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportNotebook(file, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+		t.Fatalf("export is not valid JSON: %v", err)
+	}
+	if raw["nbformat"] != 4.0 {
+		t.Errorf("expected nbformat 4, got %v", raw["nbformat"])
+	}
+	// Document metadata uses the same keys as the JSON export.
+	if doc := raw["metadata"].(map[string]any)["showboat"].(map[string]any); doc["image_names"] != "hash" {
+		t.Errorf("expected image_names in notebook metadata, got %v", doc)
+	}
+	for _, c := range raw["cells"].([]any) {
+		cell := c.(map[string]any)
+		_, hasOutputs := cell["outputs"]
+		_, hasCount := cell["execution_count"]
+		if isCode := cell["cell_type"] == "code"; hasOutputs != isCode || hasCount != isCode {
+			t.Errorf("%s cell has outputs=%v execution_count=%v", cell["cell_type"], hasOutputs, hasCount)
+		}
+	}
+
+	nbFile := filepath.Join(dir, "demo.ipynb")
+	if err := os.WriteFile(nbFile, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	imported := filepath.Join(dir, "imported.md")
+	if err := ImportNotebook(nbFile, imported, "dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	original, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readBlocks(imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(original) {
+		t.Fatalf("expected %d blocks, got %d", len(original), len(got))
+	}
+	origTitle, gotTitle := original[0].(markdown.TitleBlock), got[0].(markdown.TitleBlock)
+	if gotTitle.Title != origTitle.Title || !reflect.DeepEqual(gotTitle.Metadata, origTitle.Metadata) {
+		t.Errorf("title not restored: %+v", gotTitle)
+	}
+	if gotTitle.DocumentID == origTitle.DocumentID {
+		t.Error("imported document should have a new ID")
+	}
+	// Everything but the stored image's filename survives the round trip.
+	last := len(got) - 1
+	if !reflect.DeepEqual(got[1:last], original[1:last]) {
+		t.Errorf("blocks differ:\n got %+v\nwant %+v", got[1:last], original[1:last])
+	}
+	img := got[last].(markdown.ImageOutputBlock)
+	if img.AltText != "a red dot" {
+		t.Errorf("expected alt text to be kept, got %q", img.AltText)
+	}
+	if _, err := os.Stat(filepath.Join(dir, img.Filename)); err != nil {
+		t.Errorf("imported image not stored: %v", err)
+	}
+
+	if err := ImportNotebook(nbFile, imported, "dev"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected an error importing over an existing file, got %v", err)
+	}
+}
+
+func TestImportNotebook(t *testing.T) {
+	dir := t.TempDir()
+	// A minimal 1x1 PNG, base64-encoded as Jupyter stores it.
+	pngData := "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAIAAACQd1PeAAAADElEQVR4nGP4z8AAAAMBAQDJ/pLvAAAAAElFTkSuQmCC"
+	nb := `{
+ "nbformat": 4, "nbformat_minor": 5,
+ "metadata": {"language_info": {"name": "python"}},
+ "cells": [
+  {"cell_type": "markdown", "metadata": {}, "source": ["# Analysis"]},
+  {"cell_type": "markdown", "metadata": {}, "source": ["Load the data\n", "` + "```bash\\n" + `", "rm data.csv\n", "` + "```\\n" + `", "and count it."]},
+  {"cell_type": "markdown", "metadata": {}, "source": "## Results"},
+  {"cell_type": "code", "metadata": {}, "execution_count": 1, "source": ["print('hi')\n", "2 + 2"],
+   "outputs": [
+    {"output_type": "stream", "name": "stdout", "text": ["hi\n"]},
+    {"output_type": "execute_result", "execution_count": 1, "metadata": {}, "data": {"text/plain": ["4"]}},
+    {"output_type": "display_data", "metadata": {}, "data": {"image/png": "` + pngData + `", "text/plain": ["<Figure>"]}}
+   ]}
+ ]
+}`
+	nbFile := filepath.Join(dir, "analysis.ipynb")
+	if err := os.WriteFile(nbFile, []byte(nb), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "demo.md")
+	if err := ImportNotebook(nbFile, file, "dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := blocks[0].(markdown.TitleBlock).Title; title != "Analysis" {
+		t.Errorf("expected title from the first cell, got %q", title)
+	}
+	want := []markdown.Block{
+		// Fenced code in markdown cells stays prose.
+		markdown.CommentaryBlock{Text: "Load the data\n~~~bash\nrm data.csv\n~~~\nand count it."},
+		markdown.HeadingBlock{Level: 2, Title: "Results"},
+		markdown.CodeBlock{Lang: "python3", Code: "print('hi')\n2 + 2"},
+		markdown.OutputBlock{Content: "hi\n4\n"},
+		markdown.CodeBlock{Lang: "bash", Code: StdinImage, IsImage: true},
+	}
+	if len(blocks) != len(want)+2 || !reflect.DeepEqual(blocks[1:len(want)+1], want) {
+		t.Fatalf("unexpected blocks: %+v", blocks[1:])
+	}
+	img := blocks[len(blocks)-1].(markdown.ImageOutputBlock)
+	if img.AltText != "<Figure>" {
+		t.Errorf("expected alt text from text/plain, got %q", img.AltText)
+	}
+	if _, err := os.Stat(filepath.Join(dir, img.Filename)); err != nil {
+		t.Errorf("image not stored: %v", err)
+	}
+}
+
+func TestImportNotebookImageOptions(t *testing.T) {
+	// Options recorded on an image cell apply when its image is stored.
+	dir := t.TempDir()
+	pngData := "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAIAAACQd1PeAAAADElEQVR4nGP4z8AAAAMBAQDJ/pLvAAAAAElFTkSuQmCC"
+	nb := `{
+ "nbformat": 4, "nbformat_minor": 5, "metadata": {},
+ "cells": [
+  {"cell_type": "code", "metadata": {"showboat": {"image": true, "hash": true, "strip": true}}, "execution_count": null, "source": "plot.sh",
+   "outputs": [{"output_type": "display_data", "metadata": {}, "data": {"image/png": "` + pngData + `"}}]}
+ ]
+}`
+	nbFile := filepath.Join(dir, "plot.ipynb")
+	if err := os.WriteFile(nbFile, []byte(nb), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "demo.md")
+	if err := ImportNotebook(nbFile, file, "dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := blocks[len(blocks)-1].(markdown.ImageOutputBlock)
+	if !regexp.MustCompile(`^[0-9a-f]{16}\.png$`).MatchString(img.Filename) {
+		t.Errorf("expected a content-hash name from the cell's hash option, got %q", img.Filename)
+	}
+}
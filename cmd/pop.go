@@ -11,6 +11,23 @@ import (
 // blocks are removed. A commentary entry is a single block.
 // The title block cannot be removed.
 func Pop(file string) error {
+	return PopN(file, 1)
+}
+
+// PopN removes the n most recent entries from a showboat document, as if
+// Pop were called n times. It fails without changing the document if there
+// are fewer than n entries.
+func PopN(file string, n int) error {
+	if n < 1 {
+		return fmt.Errorf("invalid count %d: must be at least 1", n)
+	}
+
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	blocks, err := readBlocks(file)
 	if err != nil {
 		return err
@@ -20,35 +37,83 @@ func Pop(file string) error {
 		return fmt.Errorf("document is empty")
 	}
 
-	// Don't allow removing the title block.
-	if len(blocks) == 1 {
-		if _, ok := blocks[0].(markdown.TitleBlock); ok {
-			return fmt.Errorf("nothing to pop: document only contains a title")
+	docID := documentID(blocks)
+
+	for popped := 0; popped < n; popped++ {
+		// Don't allow removing the title block.
+		if len(blocks) == 1 {
+			if _, ok := blocks[0].(markdown.TitleBlock); ok {
+				if popped == 0 {
+					return fmt.Errorf("nothing to pop: document only contains a title")
+				}
+				return fmt.Errorf("cannot pop %d entries: document only has %d", n, popped)
+			}
 		}
+		blocks = blocks[:len(blocks)-entrySize(blocks, len(blocks)-1)]
 	}
 
-	docID := documentID(blocks)
+	if err := writeBlocks(file, blocks); err != nil {
+		return err
+	}
 
-	last := blocks[len(blocks)-1]
+	if docID != "" {
+		for i := 0; i < n; i++ {
+			postPop(docID)
+		}
+	}
+	return nil
+}
 
-	switch last.(type) {
+// entrySize returns how many blocks the entry ending at block i spans: 2 for
+// an output block, which is always preceded by its code block, and 1
+// otherwise.
+func entrySize(blocks []markdown.Block, i int) int {
+	switch blocks[i].(type) {
 	case markdown.OutputBlock, markdown.ImageOutputBlock:
 		// Output blocks are always preceded by a code block — remove both.
-		if len(blocks) >= 2 {
-			blocks = blocks[:len(blocks)-2]
-		} else {
-			blocks = blocks[:len(blocks)-1]
+		if i >= 1 {
+			return 2
 		}
-	default:
-		blocks = blocks[:len(blocks)-1]
 	}
+	return 1
+}
 
-	if err := writeBlocks(file, blocks); err != nil {
+// Remove deletes the entry containing block index from a showboat document.
+// Indexes count from 0 for the title, as in "verify" diffs. Removing a code
+// block also removes its output, and removing an output block also removes
+// its code block. The title block cannot be removed. Removal is not
+// streamed to a remote viewer.
+func Remove(file string, index int) error {
+	unlock, err := lockDocument(file)
+	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	if docID != "" {
-		postPop(docID)
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return err
 	}
-	return nil
+
+	if err := checkBlockIndex(blocks, index); err != nil {
+		return err
+	}
+	if _, ok := blocks[index].(markdown.TitleBlock); ok {
+		return fmt.Errorf("cannot remove the title block")
+	}
+
+	start, end := index, index+1
+	switch blocks[index].(type) {
+	case markdown.CodeBlock:
+		if end < len(blocks) && entrySize(blocks, end) == 2 {
+			end++
+		}
+	case markdown.OutputBlock, markdown.ImageOutputBlock:
+		if _, ok := blocks[index-1].(markdown.CodeBlock); ok {
+			start--
+		}
+	}
+
+	blocks = append(blocks[:start:start], blocks[end:]...)
+	return writeBlocks(file, blocks)
 }
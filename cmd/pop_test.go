@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// buildEntries creates a document with a note, an exec entry and a section:
+// blocks 0 (title), 1 (note), 2-3 (code and output) and 4 (heading).
+func buildEntries(t *testing.T) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hi", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Section(file, "Last", 2); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestPopN(t *testing.T) {
+	file := buildEntries(t)
+	if err := PopN(file, 2); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("expected title and first note to remain, got %d blocks", len(blocks))
+	}
+	if cb, ok := blocks[1].(markdown.CommentaryBlock); !ok || cb.Text != "first" {
+		t.Errorf("expected first note, got %#v", blocks[1])
+	}
+}
+
+func TestPopNTooMany(t *testing.T) {
+	file := buildEntries(t)
+	if err := PopN(file, 4); err == nil {
+		t.Fatal("expected error popping more entries than exist")
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 5 {
+		t.Errorf("expected document to be unchanged, got %d blocks", len(blocks))
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name  string
+		index int
+		want  []string
+	}{
+		{"note", 1, []string{"title", "code", "output", "heading"}},
+		{"code block", 2, []string{"title", "commentary", "heading"}},
+		{"output block", 3, []string{"title", "commentary", "heading"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := buildEntries(t)
+			if err := Remove(file, tt.index); err != nil {
+				t.Fatal(err)
+			}
+			blocks, err := readBlocks(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, b := range blocks {
+				got = append(got, b.Type())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveErrors(t *testing.T) {
+	file := buildEntries(t)
+	if err := Remove(file, 0); err == nil {
+		t.Error("expected error removing the title")
+	}
+	if err := Remove(file, 5); err == nil {
+		t.Error("expected error for a block that does not exist")
+	}
+}
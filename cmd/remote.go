@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -46,6 +47,11 @@ func postSection(uuid, command string, blocks []markdown.Block) {
 		for _, b := range blocks {
 			if tb, ok := b.(markdown.TitleBlock); ok {
 				data.Set("title", tb.Title)
+				setIfNotEmpty(data, "author", tb.Metadata.Author)
+				setIfNotEmpty(data, "agent", tb.Metadata.Agent)
+				setIfNotEmpty(data, "tags", strings.Join(tb.Metadata.Tags, ","))
+				setIfNotEmpty(data, "commit", tb.Metadata.Commit)
+				setIfNotEmpty(data, "description", tb.Metadata.Description)
 				break
 			}
 		}
@@ -53,12 +59,25 @@ func postSection(uuid, command string, blocks []markdown.Block) {
 		var buf strings.Builder
 		markdown.Write(&buf, blocks)
 		data.Set("markdown", buf.String())
+	case "section":
+		for _, b := range blocks {
+			if hb, ok := b.(markdown.HeadingBlock); ok {
+				data.Set("title", hb.Title)
+				data.Set("level", strconv.Itoa(hb.Level))
+			}
+		}
+		var buf strings.Builder
+		markdown.Write(&buf, blocks)
+		data.Set("markdown", buf.String())
 	case "exec":
 		for _, b := range blocks {
 			switch blk := b.(type) {
 			case markdown.CodeBlock:
 				data.Set("language", blk.Lang)
 				data.Set("input", blk.Code)
+				if blk.Setup {
+					data.Set("setup", "true")
+				}
 			case markdown.OutputBlock:
 				data.Set("output", blk.Content)
 			}
@@ -76,6 +95,13 @@ func postSection(uuid, command string, blocks []markdown.Block) {
 	}
 }
 
+// setIfNotEmpty sets a form field only when value is non-empty.
+func setIfNotEmpty(data url.Values, key, value string) {
+	if value != "" {
+		data.Set(key, value)
+	}
+}
+
 // postImage POSTs an image as multipart/form-data to SHOWBOAT_REMOTE_URL.
 // No-op if the env var is unset or empty.
 func postImage(uuid string, blocks []markdown.Block, imagePath string) {
@@ -234,3 +234,34 @@ func writeTestFile(path string) error {
 func writeTestFileWithContent(path string, content []byte) error {
 	return os.WriteFile(path, content, 0644)
 }
+
+func TestPostSectionInitIncludesMetadata(t *testing.T) {
+	var gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Setenv("SHOWBOAT_REMOTE_URL", server.URL)
+
+	blocks := []markdown.Block{
+		markdown.TitleBlock{Title: "Test", DocumentID: "test-uuid", Metadata: markdown.Metadata{
+			Author: "Jane",
+			Tags:   []string{"a", "b"},
+		}},
+	}
+
+	postSection("test-uuid", "init", blocks)
+
+	if !strings.Contains(gotBody, "author=Jane") {
+		t.Errorf("expected author in body, got %q", gotBody)
+	}
+	if !strings.Contains(gotBody, "tags=a%2Cb") {
+		t.Errorf("expected comma-separated tags in body, got %q", gotBody)
+	}
+	if strings.Contains(gotBody, "commit=") {
+		t.Errorf("expected unset commit to be omitted, got %q", gotBody)
+	}
+}
@@ -0,0 +1,360 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// ParseSteps reads the commands printed by "showboat extract": either one
+// "showboat ..." command line per step, or the JSON array of steps printed
+// by "showboat extract --format json". Command lines use shell quoting,
+// and quoted arguments may span lines. Blank lines and # comments are
+// ignored. Other shell syntax, such as variables, pipes or redirections, is
+// rejected.
+func ParseSteps(r io.Reader) ([]Step, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading steps: %w", err)
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var steps []Step
+		if err := json.Unmarshal(trimmed, &steps); err != nil {
+			return nil, fmt.Errorf("parsing JSON steps: %w", err)
+		}
+		for i, step := range steps {
+			if step.Command == "" {
+				return nil, fmt.Errorf("step %d: missing command", i+1)
+			}
+		}
+		return steps, nil
+	}
+
+	lines, err := splitShellWords(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var steps []Step
+	for _, line := range lines {
+		if line.words[0] != "showboat" || len(line.words) < 2 {
+			return nil, fmt.Errorf("line %d: expected a showboat command", line.number)
+		}
+		steps = append(steps, Step{Command: line.words[1], Args: line.words[2:]})
+	}
+	return steps, nil
+}
+
+// shellLine is a command line split into words, with the line number it
+// starts on.
+type shellLine struct {
+	number int
+	words  []string
+}
+
+// splitShellWords splits text into command lines of words, following the
+// shell's rules for single quotes, double quotes and backslashes.
+func splitShellWords(text string) ([]shellLine, error) {
+	var lines []shellLine
+	var words []string
+	var word strings.Builder
+	inWord := false
+	lineNo, startLine := 1, 1
+
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endLine := func() {
+		endWord()
+		if len(words) > 0 {
+			lines = append(lines, shellLine{number: startLine, words: words})
+			words = nil
+		}
+	}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if len(words) == 0 && !inWord {
+			startLine = lineNo
+		}
+		switch {
+		case r == '\n':
+			endLine()
+			lineNo++
+		case unicode.IsSpace(r):
+			endWord()
+		case r == '#' && !inWord:
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			i--
+		case r == '\'':
+			inWord = true
+			i++
+			for ; i < len(runes) && runes[i] != '\''; i++ {
+				if runes[i] == '\n' {
+					lineNo++
+				}
+				word.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated single quote", startLine)
+			}
+		case r == '"':
+			inWord = true
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				switch c := runes[i]; {
+				case c == '\\' && i+1 < len(runes) && strings.ContainsRune("\\\"$`\n", runes[i+1]):
+					i++
+					if runes[i] == '\n' {
+						lineNo++
+						continue
+					}
+					word.WriteRune(runes[i])
+				case c == '$' || c == '`':
+					return nil, fmt.Errorf("line %d: shell expansion is not supported", lineNo)
+				default:
+					if c == '\n' {
+						lineNo++
+					}
+					word.WriteRune(c)
+				}
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated double quote", startLine)
+			}
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("line %d: trailing backslash", lineNo)
+			}
+			i++
+			if runes[i] == '\n' {
+				// Line continuation.
+				lineNo++
+				continue
+			}
+			inWord = true
+			word.WriteRune(runes[i])
+		case strings.ContainsRune("$`|&;<>()", r):
+			return nil, fmt.Errorf("line %d: unsupported shell syntax %q", lineNo, r)
+		default:
+			inWord = true
+			word.WriteRune(r)
+		}
+	}
+	endLine()
+	return lines, nil
+}
+
+// Replay runs steps in order through the cmd package, as if each were run
+// as a showboat command, with code running in workdir. Documents it creates
+// record version as the showboat version. Before each step it
+// writes a "[i/n] command" progress line to progress. It stops at the first
+// step that fails, including an exec step whose code no longer exits with
+// its expected exit code, and returns an error naming that step.
+func Replay(steps []Step, workdir, version string, progress io.Writer) error {
+	for i, step := range steps {
+		summary := step.String()
+		if first, _, multi := strings.Cut(summary, "\n"); multi {
+			summary = first + " ..."
+		}
+		fmt.Fprintf(progress, "[%d/%d] %s\n", i+1, len(steps), summary)
+		if err := runStep(step, workdir, version); err != nil {
+			return fmt.Errorf("step %d/%d (showboat %s) failed: %w", i+1, len(steps), step.Command, err)
+		}
+	}
+	return nil
+}
+
+// stepValueFlags lists, for each command Replay supports, the flags that
+// take a value.
+var stepValueFlags = map[string][]string{
+	"init":    {"--author", "--agent", "--tag", "--commit", "--description", "--image-names", "--assets", "--image-budget", "--source"},
+	"note":    {"--after"},
+	"section": {"--level"},
+	"exec":    {"--expect-exit", "--match", "--replace"},
+	"image":   {"--max-width", "--quality", "--alt"},
+	"pop":     {"-n"},
+}
+
+// stepBoolFlags lists the flags without a value that each command accepts.
+// Any other argument is positional, even if it starts with "--", such as a
+// note or SQL code that begins with a dash.
+var stepBoolFlags = map[string][]string{
+	"exec":  {"--setup", "--expect-failure"},
+	"image": {"--run", "--hash", "--strip"},
+}
+
+// parseStepArgs separates a step's arguments into positional arguments and
+// flags. Repeated flags keep every value.
+func parseStepArgs(step Step) (positional []string, flags map[string][]string, err error) {
+	valueFlags, ok := stepValueFlags[step.Command]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported command: %s", step.Command)
+	}
+	flags = map[string][]string{}
+	for i := 0; i < len(step.Args); i++ {
+		arg := step.Args[i]
+		switch {
+		case slices.Contains(valueFlags, arg):
+			if i+1 == len(step.Args) {
+				return nil, nil, fmt.Errorf("%s requires a value", arg)
+			}
+			flags[arg] = append(flags[arg], step.Args[i+1])
+			i++
+		case slices.Contains(stepBoolFlags[step.Command], arg):
+			flags[arg] = append(flags[arg], "")
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	return positional, flags, nil
+}
+
+// runStep runs a single step.
+func runStep(step Step, workdir, version string) error {
+	args, flags, err := parseStepArgs(step)
+	if err != nil {
+		return err
+	}
+	flag := func(name string) string {
+		if v := flags[name]; len(v) > 0 {
+			return v[len(v)-1]
+		}
+		return ""
+	}
+	intFlag := func(name string, def int) (int, error) {
+		v := flag(name)
+		if v == "" {
+			return def, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %s", name, v)
+		}
+		return n, nil
+	}
+	need := func(n int, usage string) error {
+		if len(args) < n {
+			return fmt.Errorf("usage: showboat %s %s", step.Command, usage)
+		}
+		return nil
+	}
+
+	switch step.Command {
+	case "init":
+		if err := need(2, "<file> <title>"); err != nil {
+			return err
+		}
+		meta := markdown.Metadata{
+			Author:      flag("--author"),
+			Agent:       flag("--agent"),
+			Tags:        flags["--tag"],
+			Commit:      flag("--commit"),
+			Description: flag("--description"),
+			ImageNames:  flag("--image-names"),
+			Assets:      flag("--assets"),
+			ImageBudget: flag("--image-budget"),
+			Sources:     flags["--source"],
+		}
+		return InitWithMetadata(args[0], args[1], version, meta)
+
+	case "note":
+		if err := need(2, "<file> <text>"); err != nil {
+			return err
+		}
+		if _, ok := flags["--after"]; ok {
+			after, err := intFlag("--after", 0)
+			if err != nil {
+				return err
+			}
+			return NoteAfter(args[0], args[1], after)
+		}
+		return Note(args[0], args[1])
+
+	case "section":
+		if err := need(2, "<file> <title>"); err != nil {
+			return err
+		}
+		level, err := intFlag("--level", 2)
+		if err != nil {
+			return err
+		}
+		return Section(args[0], args[1], level)
+
+	case "exec":
+		if err := need(3, "<file> <lang> <code>"); err != nil {
+			return err
+		}
+		block := markdown.CodeBlock{Lang: args[1], Code: args[2], Match: flag("--match")}
+		if block.Match != "" && !markdown.IsMatchMode(block.Match) {
+			return fmt.Errorf("invalid --match: %s", block.Match)
+		}
+		_, block.Setup = flags["--setup"]
+		_, block.ExpectFailure = flags["--expect-failure"]
+		if block.ExpectExit, err = intFlag("--expect-exit", 0); err != nil {
+			return err
+		}
+		var exitCode int
+		if _, ok := flags["--replace"]; ok {
+			index, err := intFlag("--replace", 0)
+			if err != nil {
+				return err
+			}
+			_, exitCode, err = ExecReplace(args[0], block, workdir, index)
+			if err != nil {
+				return err
+			}
+		} else {
+			_, exitCode, err = ExecBlock(args[0], block, workdir)
+			if err != nil {
+				return err
+			}
+		}
+		// Code without an expected exit code may fail, as it may have when
+		// it was recorded; "verify" checks the output it recorded.
+		if (block.ExpectExit != 0 || block.ExpectFailure) && !ExitCodeMatches(block, exitCode) {
+			return fmt.Errorf("expected exit code %s, got %d", DescribeExpectedExit(block), exitCode)
+		}
+		return nil
+
+	case "image":
+		if err := need(2, "<file> <image|![alt](image)|script>"); err != nil {
+			return err
+		}
+		opts := ImageOptions{Alt: flag("--alt")}
+		_, opts.Run = flags["--run"]
+		_, opts.ContentHash = flags["--hash"]
+		_, opts.Strip = flags["--strip"]
+		if opts.MaxWidth, err = intFlag("--max-width", 0); err != nil {
+			return err
+		}
+		if opts.Quality, err = intFlag("--quality", 0); err != nil {
+			return err
+		}
+		return ImageWithOptions(args[0], args[1], workdir, opts)
+
+	case "pop":
+		if err := need(1, "<file>"); err != nil {
+			return err
+		}
+		n, err := intFlag("-n", 1)
+		if err != nil {
+			return err
+		}
+		return PopN(args[0], n)
+	}
+	return fmt.Errorf("unsupported command: %s", step.Command)
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestParseStepsCommands(t *testing.T) {
+	input := "# rebuild\nshowboat init demo.md 'My Demo' --tag a\n\n" +
+		"showboat exec demo.md bash 'echo '\\''hi'\\''\necho two' --setup\n" +
+		"showboat note demo.md \"say \\\"hi\\\"\" \\\n  --after 1\n"
+	steps, err := ParseSteps(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Step{
+		{Command: "init", Args: []string{"demo.md", "My Demo", "--tag", "a"}},
+		{Command: "exec", Args: []string{"demo.md", "bash", "echo 'hi'\necho two", "--setup"}},
+		{Command: "note", Args: []string{"demo.md", `say "hi"`, "--after", "1"}},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("expected %#v, got %#v", want, steps)
+	}
+}
+
+func TestParseStepsErrors(t *testing.T) {
+	for _, input := range []string{
+		"showboat note demo.md 'unterminated",
+		"showboat note demo.md $HOME",
+		"showboat note demo.md hi | cat",
+		"rm -rf demo.md",
+	} {
+		if _, err := ParseSteps(strings.NewReader(input)); err == nil {
+			t.Errorf("expected error parsing %q", input)
+		}
+	}
+}
+
+func TestParseStepsJSON(t *testing.T) {
+	steps, err := ParseSteps(strings.NewReader(`[{"command": "note", "args": ["demo.md", "hi"]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 || steps[0].Command != "note" || steps[0].Args[1] != "hi" {
+		t.Errorf("unexpected steps %#v", steps)
+	}
+}
+
+func TestReplayRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	meta := markdown.Metadata{Author: "Jane", Tags: []string{"x", "y"}}
+	if err := InitWithMetadata(file, "Replay", "dev", meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "It's a\nmulti-line note."); err != nil {
+		t.Fatal(err)
+	}
+	if err := Section(file, "Details", 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecBlock(file, markdown.CodeBlock{Lang: "bash", Code: "echo \"$((6*7))\"\nexit 2", ExpectExit: 2}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	copyFile := filepath.Join(dir, "copy.md")
+	for _, format := range []string{"commands", "json"} {
+		os.Remove(copyFile)
+		var input string
+		if format == "json" {
+			steps, err := ExtractSteps(file, copyFile, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(steps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			input = string(data)
+		} else {
+			commands, err := Extract(file, copyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			input = strings.Join(commands, "\n")
+		}
+
+		steps, err := ParseSteps(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var progress strings.Builder
+		if err := Replay(steps, "", "dev", &progress); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if !strings.Contains(progress.String(), "[4/4] showboat exec") {
+			t.Errorf("%s: expected progress lines, got:\n%s", format, progress.String())
+		}
+
+		original, _ := os.ReadFile(file)
+		replayed, _ := os.ReadFile(copyFile)
+		body := func(doc []byte) string { return string(doc[strings.Index(string(doc), "-->"):]) }
+		if body(replayed) != body(original) {
+			t.Errorf("%s: replayed document differs.\noriginal:\n%s\nreplayed:\n%s", format, original, replayed)
+		}
+	}
+}
+
+func TestReplayDashArguments(t *testing.T) {
+	// Note text and code that start with "--" are not flags.
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := InitWithMetadata(file, "Dashes", "dev", markdown.Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "--verbose prints more"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecBlock(file, markdown.CodeBlock{Lang: "bash", Code: "--version 2>/dev/null; echo ok"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	copyFile := filepath.Join(dir, "copy.md")
+	for _, format := range []string{"commands", "json"} {
+		os.Remove(copyFile)
+		var input string
+		if format == "json" {
+			steps, err := ExtractSteps(file, copyFile, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(steps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			input = string(data)
+		} else {
+			commands, err := Extract(file, copyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			input = strings.Join(commands, "\n")
+		}
+
+		steps, err := ParseSteps(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Replay(steps, "", "dev", io.Discard); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		replayed, _ := os.ReadFile(copyFile)
+		for _, want := range []string{"--verbose prints more\n", "```bash\n--version 2>/dev/null; echo ok\n```"} {
+			if !strings.Contains(string(replayed), want) {
+				t.Errorf("%s: expected %q in replayed document:\n%s", format, want, replayed)
+			}
+		}
+	}
+}
+
+func TestReplayStopsAtFailure(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	steps := []Step{
+		{Command: "init", Args: []string{file, "Test"}},
+		// Exit codes are only checked against an expectation.
+		{Command: "exec", Args: []string{file, "bash", "echo failed; exit 1"}},
+		{Command: "exec", Args: []string{file, "bash", "exit 3", "--expect-exit", "2"}},
+		{Command: "note", Args: []string{file, "never"}},
+	}
+	var progress strings.Builder
+	err := Replay(steps, "", "dev", &progress)
+	if err == nil {
+		t.Fatal("expected replay to fail")
+	}
+	if !strings.Contains(err.Error(), "step 3/4") || !strings.Contains(err.Error(), "expected exit code 2, got 3") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if strings.Contains(progress.String(), "[4/4]") {
+		t.Error("expected replay to stop before step 4")
+	}
+
+	if err := Replay([]Step{{Command: "verify", Args: []string{file}}}, "", "dev", &progress); err == nil {
+		t.Error("expected error for an unsupported command")
+	}
+}
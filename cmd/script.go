@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// ExtractScript is like ExtractSection but returns a complete bash script
+// that rebuilds the document. The script runs with "set -e", passes
+// multi-line text as quoted heredocs, and runs code in $WORKDIR (default:
+// the directory it is run from). It builds the document in a temporary file
+// next to it and only replaces the document once every step has succeeded,
+// so a failed run leaves an existing copy untouched. Images are added from
+// the copies stored next to the original document, so the script works in a
+// clean checkout that does not have the files the images were first added
+// from. Code blocks with an expected exit code stop the script if they no
+// longer exit with it; other code blocks may exit non-zero, as they may
+// have when they were recorded.
+func ExtractScript(file, outputFile, section string) (string, error) {
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return "", err
+	}
+
+	start, end, err := sectionRange(blocks, section)
+	if err != nil {
+		return "", err
+	}
+
+	target := file
+	if outputFile != "" {
+		target = outputFile
+	}
+	images := filepath.ToSlash(filepath.Dir(file))
+	if assets := documentMetadata(blocks).Assets; assets != "" {
+		images = path.Join(images, assets)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#!/usr/bin/env bash\n")
+	fmt.Fprintf(&sb, "# Rebuilds %s. Generated by \"showboat extract --format script\".\n", target)
+	fmt.Fprintf(&sb, "set -e\n\n")
+	fmt.Fprintf(&sb, "DOC=%s\n", shellQuote(target))
+	fmt.Fprintf(&sb, "# Images are added from the copies stored with the original document.\n")
+	fmt.Fprintf(&sb, "IMAGES=%s\n", shellQuote(images))
+	fmt.Fprintf(&sb, "# Code runs in WORKDIR, which defaults to the current directory.\n")
+	fmt.Fprintf(&sb, "WORKDIR=\"${WORKDIR:-$PWD}\"\n\n")
+	fmt.Fprintf(&sb, "# The document is built next to $DOC and moved into place on success.\n")
+	fmt.Fprintf(&sb, "BUILD=\"$(dirname \"$DOC\")/.rebuild-$$-$(basename \"$DOC\")\"\n")
+	fmt.Fprintf(&sb, "trap 'rm -f \"$BUILD\" \"$(dirname \"$BUILD\")/.$(basename \"$BUILD\")\".*' EXIT\n\n")
+
+	for i, block := range blocks {
+		if !inSection(blocks, i, start, end) {
+			continue
+		}
+		switch b := block.(type) {
+		case markdown.TitleBlock:
+			warnExtraFrontMatter(b.Metadata)
+			fmt.Fprintf(&sb, "showboat init \"$BUILD\" %s%s\n", shellQuote(b.Title), shellArgs(metadataFlags(b.Metadata)))
+		case markdown.CommentaryBlock:
+			sb.WriteString(scriptCommand("showboat note \"$BUILD\"", b.Text, ""))
+		case markdown.HeadingBlock:
+			cmd := fmt.Sprintf("showboat section \"$BUILD\" %s", shellQuote(b.Title))
+			if b.Level != 2 {
+				cmd += fmt.Sprintf(" --level %d", b.Level)
+			}
+			sb.WriteString(cmd + "\n")
+		case markdown.CodeBlock:
+			switch {
+			case b.IsImage && b.Run:
+				flags := imageFlags(b)
+				if img, ok := imageOutputAt(blocks, i); ok {
+					flags = append(flags, altFlag(b, b.Code, img)...)
+				}
+				sb.WriteString(scriptCommand("showboat --workdir \"$WORKDIR\" image \"$BUILD\""+shellArgs(flags), b.Code, ""))
+			case b.IsImage:
+				img, ok := imageOutputAt(blocks, i)
+				if !ok {
+					continue
+				}
+				name := path.Base(img.Filename)
+				fmt.Fprintf(&sb, "showboat image \"$BUILD\" \"$IMAGES\"/%s --alt %s%s\n", shellQuote(name), shellQuote(img.AltText), shellArgs(imageFlags(b)))
+			default:
+				prefix := fmt.Sprintf("showboat --workdir \"$WORKDIR\" exec \"$BUILD\" %s%s", shellQuote(b.Lang), shellArgs(codeFlags(b)))
+				suffix := ""
+				if b.ExpectExit == 0 && !b.ExpectFailure {
+					suffix = " || true"
+				}
+				sb.WriteString(scriptCommand(prefix, b.Code, suffix))
+			}
+		}
+	}
+	fmt.Fprintf(&sb, "\nmv \"$BUILD\" \"$DOC\"\n")
+	return sb.String(), nil
+}
+
+// imageOutputAt returns the image reference recorded for the image code
+// block at index i.
+func imageOutputAt(blocks []markdown.Block, i int) (markdown.ImageOutputBlock, bool) {
+	if i+1 >= len(blocks) {
+		return markdown.ImageOutputBlock{}, false
+	}
+	img, ok := blocks[i+1].(markdown.ImageOutputBlock)
+	return img, ok
+}
+
+// scriptCommand returns the script lines that run prefix with text as its
+// final argument, followed by suffix (such as " || true"). Single-line text
+// is single-quoted. Multi-line text is written out verbatim in a quoted
+// heredoc: piped to stdin when it ends with a newline, and otherwise passed
+// through "$(cat)", which drops the heredoc's final newline, so the text
+// arrives unchanged either way.
+func scriptCommand(prefix, text, suffix string) string {
+	if !strings.Contains(text, "\n") {
+		return prefix + " " + shellQuote(text) + suffix + "\n"
+	}
+	delim := heredocDelimiter(text)
+	if body, ok := strings.CutSuffix(text, "\n"); ok {
+		return fmt.Sprintf("%s <<'%s'%s\n%s\n%s\n", prefix, delim, suffix, body, delim)
+	}
+	return fmt.Sprintf("%s \"$(cat <<'%s'\n%s\n%s\n)\"%s\n", prefix, delim, text, delim, suffix)
+}
+
+// heredocDelimiter returns a heredoc delimiter that does not appear as a
+// line of text.
+func heredocDelimiter(text string) string {
+	lines := map[string]bool{}
+	for _, line := range strings.Split(text, "\n") {
+		lines[line] = true
+	}
+	delim := "SHOWBOAT_EOF"
+	for n := 1; lines[delim]; n++ {
+		delim = fmt.Sprintf("SHOWBOAT_EOF_%d", n)
+	}
+	return delim
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestScriptCommand(t *testing.T) {
+	tests := []struct {
+		text   string
+		suffix string
+		want   string
+	}{
+		{"echo hi", "", "cmd 'echo hi'\n"},
+		{"a\nb\n", "", "cmd <<'SHOWBOAT_EOF'\na\nb\nSHOWBOAT_EOF\n"},
+		{"a\nb", "", "cmd \"$(cat <<'SHOWBOAT_EOF'\na\nb\nSHOWBOAT_EOF\n)\"\n"},
+		{"SHOWBOAT_EOF\n", "", "cmd <<'SHOWBOAT_EOF_1'\nSHOWBOAT_EOF\nSHOWBOAT_EOF_1\n"},
+		{"echo hi", " || true", "cmd 'echo hi' || true\n"},
+		{"a\nb\n", " || true", "cmd <<'SHOWBOAT_EOF' || true\na\nb\nSHOWBOAT_EOF\n"},
+		{"a\nb", " || true", "cmd \"$(cat <<'SHOWBOAT_EOF'\na\nb\nSHOWBOAT_EOF\n)\" || true\n"},
+	}
+	for _, tt := range tests {
+		if got := scriptCommand("cmd", tt.text, tt.suffix); got != tt.want {
+			t.Errorf("scriptCommand(%q, %q) = %q, want %q", tt.text, tt.suffix, got, tt.want)
+		}
+	}
+}
+
+func TestScriptCommandPreservesText(t *testing.T) {
+	// Run each command through bash with "cmd" printing its argument or
+	// stdin, and check the text arrives unchanged.
+	cmdFunc := `cmd() { if [ $# -gt 0 ]; then printf '%s' "$1"; else cat; fi; }` + "\n"
+	for _, text := range []string{"one line", "two\nlines", "trailing\nnewline\n", "blank\n\nlines\n\n", "it's $HOME `x`\n"} {
+		out, err := exec.Command("bash", "-c", cmdFunc+scriptCommand("cmd", text, "")).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != text {
+			t.Errorf("expected %q, got %q", text, out)
+		}
+	}
+}
+
+func TestExtractScript(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := InitWithMetadata(file, "Test", "dev", markdown.Metadata{Assets: "img"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecBlock(file, markdown.CodeBlock{Lang: "bash", Code: "echo one\necho two", Setup: true}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecBlock(file, markdown.CodeBlock{Lang: "bash", Code: "exit 3", ExpectExit: 3}, ""); err != nil {
+		t.Fatal(err)
+	}
+	pngPath := filepath.Join(dir, "test.png")
+	if err := os.WriteFile(pngPath, minimalPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Image(file, "![A chart]("+pngPath+")", ""); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := filepath.Base(blocks[6].(markdown.ImageOutputBlock).Filename)
+
+	script, err := ExtractScript(file, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"#!/usr/bin/env bash\n",
+		"set -e\n",
+		"IMAGES=" + shellQuote(filepath.ToSlash(dir)+"/img") + "\n",
+		"showboat init \"$BUILD\" Test --assets img\n",
+		"showboat --workdir \"$WORKDIR\" exec \"$BUILD\" bash --setup \"$(cat <<'SHOWBOAT_EOF'\necho one\necho two\nSHOWBOAT_EOF\n)\" || true\n",
+		"showboat --workdir \"$WORKDIR\" exec \"$BUILD\" bash --expect-exit 3 'exit 3'\n",
+		"showboat image \"$BUILD\" \"$IMAGES\"/" + stored + " --alt 'A chart'\n",
+		"\nmv \"$BUILD\" \"$DOC\"\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected script to contain %q, got:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, pngPath) {
+		t.Error("expected script not to reference the original image path")
+	}
+}
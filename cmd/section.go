@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// Section appends a section heading to an existing showboat document. Level
+// is the heading depth from 2 (##) to 6 (######).
+func Section(file, title string, level int) error {
+	if level < 2 || level > 6 {
+		return fmt.Errorf("invalid heading level %d: must be between 2 and 6", level)
+	}
+	title = strings.TrimSpace(title)
+	if title == "" || strings.Contains(title, "\n") {
+		return fmt.Errorf("section title must be a single non-empty line")
+	}
+
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return err
+	}
+
+	newBlock := markdown.HeadingBlock{Level: level, Title: title}
+	blocks = append(blocks, newBlock)
+
+	if err := writeBlocks(file, blocks); err != nil {
+		return err
+	}
+
+	docID := documentID(blocks)
+	if docID != "" {
+		postSection(docID, "section", []markdown.Block{newBlock})
+	}
+	return nil
+}
+
+// TableOfContents returns a nested markdown list linking to every section
+// heading in a document, one line per heading.
+func TableOfContents(file string) ([]string, error) {
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	seen := map[string]int{}
+	for _, block := range blocks {
+		h, ok := block.(markdown.HeadingBlock)
+		if !ok {
+			continue
+		}
+		anchor := headingAnchor(h.Title)
+		if n := seen[anchor]; n > 0 {
+			seen[anchor]++
+			anchor = fmt.Sprintf("%s-%d", anchor, n)
+		} else {
+			seen[anchor] = 1
+		}
+		indent := strings.Repeat("  ", h.Level-2)
+		lines = append(lines, fmt.Sprintf("%s- [%s](#%s)", indent, h.Title, anchor))
+	}
+	return lines, nil
+}
+
+// headingAnchor returns the GitHub-style anchor for a heading: lower case,
+// punctuation removed and spaces replaced with hyphens.
+func headingAnchor(title string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case r == ' ':
+			sb.WriteRune('-')
+		case r == '-' || r == '_':
+			sb.WriteRune(r)
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r > 127:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// readSection reads a document like readBlocks, keeping only its title and
+// the blocks of the named section. An empty section keeps every block.
+func readSection(file, section string) ([]markdown.Block, error) {
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := sectionRange(blocks, section)
+	if err != nil {
+		return nil, err
+	}
+	if section == "" {
+		return blocks, nil
+	}
+	var selected []markdown.Block
+	if _, ok := blocks[0].(markdown.TitleBlock); ok && start > 0 {
+		selected = append(selected, blocks[0])
+	}
+	return append(selected, blocks[start:end]...), nil
+}
+
+// inSection reports whether blocks[i] is part of a section whose blocks are
+// start to end, as sectionRange returns them. The title and setup entries
+// ahead of the section are included too, since the section may depend on
+// them, as "verify --section" runs them.
+func inSection(blocks []markdown.Block, i, start, end int) bool {
+	if i >= start && i < end {
+		return true
+	}
+	if i >= start {
+		return false
+	}
+	switch b := blocks[i].(type) {
+	case markdown.TitleBlock:
+		return true
+	case markdown.CodeBlock:
+		return b.Setup
+	case markdown.OutputBlock, markdown.ImageOutputBlock:
+		if i == 0 {
+			return false
+		}
+		cb, ok := blocks[i-1].(markdown.CodeBlock)
+		return ok && cb.Setup
+	}
+	return false
+}
+
+// sectionRange returns the half-open range of block indices covered by the
+// first heading titled title: the heading itself through to the next heading
+// of the same or a higher level. An empty title selects the whole document.
+func sectionRange(blocks []markdown.Block, title string) (start, end int, err error) {
+	if title == "" {
+		return 0, len(blocks), nil
+	}
+	start = -1
+	level := 0
+	for i, block := range blocks {
+		h, ok := block.(markdown.HeadingBlock)
+		if !ok {
+			continue
+		}
+		if start == -1 {
+			if strings.EqualFold(h.Title, title) {
+				start, level = i, h.Level
+			}
+			continue
+		}
+		if h.Level <= level {
+			return start, i, nil
+		}
+	}
+	if start == -1 {
+		return 0, 0, fmt.Errorf("section not found: %s", title)
+	}
+	return start, len(blocks), nil
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestSection(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Section(file, "Getting started", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(content), "\n## Getting started\n<!-- showboat-section -->\n") {
+		t.Errorf("expected heading in file, got: %s", content)
+	}
+}
+
+func TestSectionInvalidLevel(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Section(file, "Too shallow", 1); err == nil {
+		t.Error("expected error for level 1 heading")
+	}
+}
+
+// buildSectionedDoc creates a document with two top-level sections, the first
+// of which has a subsection.
+func buildSectionedDoc(t *testing.T) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "demo.md")
+	steps := []func() error{
+		func() error { return Init(file, "Test", "dev") },
+		func() error { return Section(file, "Install", 2) },
+		func() error { _, _, err := Exec(file, "bash", "echo install", ""); return err },
+		func() error { return Section(file, "Check it", 3) },
+		func() error { _, _, err := Exec(file, "bash", "echo check", ""); return err },
+		func() error { return Section(file, "Use", 2) },
+		func() error { _, _, err := Exec(file, "bash", "echo use", ""); return err },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return file
+}
+
+func TestExtractSection(t *testing.T) {
+	file := buildSectionedDoc(t)
+
+	commands, err := ExtractSection(file, "demo.md", "install")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"showboat init demo.md Test",
+		"showboat section demo.md Install",
+		"showboat exec demo.md bash 'echo install'",
+		"showboat section demo.md 'Check it' --level 3",
+		"showboat exec demo.md bash 'echo check'",
+	}
+	if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected commands:\n%s", strings.Join(commands, "\n"))
+	}
+
+	if _, err := ExtractSection(file, "", "Missing"); err == nil {
+		t.Error("expected error for unknown section")
+	}
+}
+
+func TestVerifySection(t *testing.T) {
+	file := buildSectionedDoc(t)
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(content), "```output\nuse\n```", "```output\nwrong\n```", 1)
+	if err := os.WriteFile(file, []byte(tampered), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := VerifyWithOptions(file, VerifyOptions{Section: "Install"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected no diffs in Install section, got %v", diffs)
+	}
+
+	diffs, err = VerifyWithOptions(file, VerifyOptions{Section: "Use"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 {
+		t.Errorf("expected 1 diff in Use section, got %d", len(diffs))
+	}
+}
+
+func TestTableOfContents(t *testing.T) {
+	file := buildSectionedDoc(t)
+
+	lines, err := TableOfContents(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"- [Install](#install)",
+		"  - [Check it](#check-it)",
+		"- [Use](#use)",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected table of contents:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestVerifySectionRunsEarlierSetup(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	work := t.TempDir()
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	setup := markdown.CodeBlock{Lang: "bash", Code: "echo ready > state.txt", Setup: true}
+	if _, _, err := ExecBlock(file, setup, work); err != nil {
+		t.Fatal(err)
+	}
+	if err := Section(file, "Read", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "cat state.txt", work); err != nil {
+		t.Fatal(err)
+	}
+
+	// Start from a clean working directory: the section only passes if the
+	// setup block outside it is run first.
+	fresh := t.TempDir()
+	diffs, err := VerifyWithOptions(file, VerifyOptions{Workdir: fresh, Section: "Read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected no diffs, got %v", diffs)
+	}
+}
+
+func TestExtractSectionKeepsEarlierSetup(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	work := t.TempDir()
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	setup := markdown.CodeBlock{Lang: "bash", Code: "echo ready > f.txt", Setup: true}
+	if _, _, err := ExecBlock(file, setup, work); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo skipped", work); err != nil {
+		t.Fatal(err)
+	}
+	if err := Section(file, "Part A", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "cat f.txt", work); err != nil {
+		t.Fatal(err)
+	}
+
+	commands, err := ExtractSection(file, "demo.md", "Part A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"showboat init demo.md Test",
+		"showboat exec demo.md bash 'echo ready > f.txt' --setup",
+		"showboat section demo.md 'Part A'",
+		"showboat exec demo.md bash 'cat f.txt'",
+	}
+	if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected commands:\n%s", strings.Join(commands, "\n"))
+	}
+
+	script, err := ExtractScript(file, "demo.md", "Part A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script, "echo ready > f.txt") || strings.Contains(script, "echo skipped") {
+		t.Errorf("expected only the setup block ahead of the section, got:\n%s", script)
+	}
+
+	paths, err := Tangle(file, t.TempDir(), "Part A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tangled, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(tangled), "echo ready > f.txt") || strings.Contains(string(tangled), "echo skipped") {
+		t.Errorf("expected only the setup block ahead of the section, got:\n%s", tangled)
+	}
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/simonw/showboat/markdown"
+)
+
+// SplitOptions controls where Split divides a document. Exactly one of
+// ByHeading and Every must be set.
+type SplitOptions struct {
+	// ByHeading starts a new part at each top-level section heading.
+	ByHeading bool
+	// Every starts a new part after every Every entries.
+	Every int
+	// Dir is the directory the parts are written to. Empty means the
+	// document's own directory.
+	Dir string
+}
+
+// Split divides a showboat document into several new documents, named
+// <name>-01.md, <name>-02.md and so on, and returns their paths. The original
+// document is not changed.
+//
+// Each part gets a new title and document ID, the front matter of the
+// original with its ID in "sources", and copies of its images in its own
+// assets location. Parts split by heading are titled after their heading,
+// which is removed, and their subsections move one level up; entries before
+// the first heading form a part titled like the original. Setup entries
+// from earlier parts are repeated at the start of each part, so that every
+// part can be verified on its own. Split fails without writing anything if
+// any part's file exists, and removes the parts it wrote if a later part
+// fails; images copied for them are left for "gc" to clean up.
+func Split(file, version string, opts SplitOptions) ([]string, error) {
+	if opts.ByHeading == (opts.Every != 0) {
+		return nil, fmt.Errorf("split by heading or every N entries, not both or neither")
+	}
+	if opts.Every < 0 {
+		return nil, fmt.Errorf("invalid count %d: must be at least 1", opts.Every)
+	}
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("document is empty")
+	}
+	title, _ := blocks[0].(markdown.TitleBlock)
+
+	var parts []splitPart
+	if opts.ByHeading {
+		parts, err = splitByHeading(blocks, title.Title)
+	} else {
+		parts = splitEvery(blocks, title.Title, opts.Every)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = filepath.Dir(file)
+	}
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	paths := make([]string, len(parts))
+	for i := range parts {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("%s-%02d.md", base, i+1))
+		if _, err := os.Stat(paths[i]); err == nil {
+			return nil, fmt.Errorf("file already exists: %s", paths[i])
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating directory: %w", err)
+	}
+
+	meta := title.Metadata
+	meta.Sources = nil
+	if title.DocumentID != "" {
+		meta.Sources = []string{title.DocumentID}
+	}
+	var setup []markdown.Block
+	for i, part := range parts {
+		partBlocks := []markdown.Block{markdown.TitleBlock{
+			Title:      part.title,
+			Timestamp:  time.Now().UTC().Format(time.RFC3339),
+			Version:    version,
+			DocumentID: uuid.New().String(),
+			Metadata:   meta,
+		}}
+		partBlocks = append(partBlocks, setup...)
+		partBlocks = append(partBlocks, part.blocks...)
+		setup = append(setup, setupEntries(part.blocks)...)
+
+		if err := writeSplitPart(file, paths[i], partBlocks); err != nil {
+			for _, written := range paths[:i] {
+				os.Remove(written)
+			}
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// splitPart is a run of blocks from a document that becomes a new document.
+type splitPart struct {
+	title  string
+	blocks []markdown.Block
+}
+
+// splitByHeading divides blocks at each heading of the highest level used in
+// the document.
+func splitByHeading(blocks []markdown.Block, title string) ([]splitPart, error) {
+	level := 0
+	for _, block := range blocks {
+		if h, ok := block.(markdown.HeadingBlock); ok && (level == 0 || h.Level < level) {
+			level = h.Level
+		}
+	}
+	if level == 0 {
+		return nil, fmt.Errorf("no section headings to split at")
+	}
+
+	parts := []splitPart{{title: title}}
+	for _, block := range blocks[1:] {
+		if h, ok := block.(markdown.HeadingBlock); ok {
+			if h.Level == level {
+				parts = append(parts, splitPart{title: h.Title})
+				continue
+			}
+			// Subsections move up, but stay below the document title.
+			h.Level = max(h.Level-level+1, 2)
+			block = h
+		}
+		last := &parts[len(parts)-1]
+		last.blocks = append(last.blocks, block)
+	}
+	if len(parts[0].blocks) == 0 {
+		parts = parts[1:]
+	}
+	return parts, nil
+}
+
+// splitEvery divides blocks into parts of n entries, titled "<title> (part i
+// of k)".
+func splitEvery(blocks []markdown.Block, title string, n int) []splitPart {
+	var parts []splitPart
+	count := 0
+	for i := 1; i < len(blocks); {
+		size := 1
+		if i+1 < len(blocks) && entrySize(blocks, i+1) == 2 {
+			if _, ok := blocks[i].(markdown.CodeBlock); ok {
+				size = 2
+			}
+		}
+		if count%n == 0 {
+			parts = append(parts, splitPart{})
+		}
+		last := &parts[len(parts)-1]
+		last.blocks = append(last.blocks, blocks[i:i+size]...)
+		count++
+		i += size
+	}
+	for i := range parts {
+		parts[i].title = fmt.Sprintf("%s (part %d of %d)", strings.Join(strings.Fields(title), " "), i+1, len(parts))
+	}
+	return parts
+}
+
+// setupEntries returns the setup code blocks in blocks, with their output.
+func setupEntries(blocks []markdown.Block) []markdown.Block {
+	var setup []markdown.Block
+	for i, block := range blocks {
+		if cb, ok := block.(markdown.CodeBlock); ok && cb.Setup {
+			setup = append(setup, cb)
+			if i+1 < len(blocks) && entrySize(blocks, i+1) == 2 {
+				setup = append(setup, blocks[i+1])
+			}
+		}
+	}
+	return setup
+}
+
+// writeSplitPart creates the document part with blocks taken from the
+// document at file, copying the images it references into its assets
+// location.
+func writeSplitPart(file, part string, blocks []markdown.Block) error {
+	// Images copied before a failure are left for "gc" to clean up.
+	destDir, prefix, err := assetDir(part, blocks)
+	if err != nil {
+		return err
+	}
+	copyOpts := imageCopyOptions(blocks)
+	for i, block := range blocks {
+		if img, ok := block.(markdown.ImageOutputBlock); ok {
+			img, err = rehomeImage(file, img, destDir, prefix, copyOpts)
+			if err != nil {
+				return err
+			}
+			blocks[i] = img
+		}
+	}
+	return createDocument(part, blocks)
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestSplitByHeading(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := InitWithMetadata(file, "Demo", "dev", markdown.Metadata{Author: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecBlock(file, markdown.CodeBlock{Lang: "bash", Code: "echo setup", Setup: true}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Section(file, "First", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo one", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Section(file, "Detail", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := Section(file, "Second", 2); err != nil {
+		t.Fatal(err)
+	}
+	writePixelPNG(t, filepath.Join(dir, "dot.png"), color.RGBA{R: 255, A: 255})
+	if err := Image(file, "![dot]("+filepath.Join(dir, "dot.png")+")", ""); err != nil {
+		t.Fatal(err)
+	}
+	original, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := Split(file, "dev", SplitOptions{ByHeading: true, Dir: filepath.Join(dir, "parts")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 3 || filepath.Base(paths[0]) != "demo-01.md" || filepath.Base(paths[2]) != "demo-03.md" {
+		t.Fatalf("unexpected parts: %v", paths)
+	}
+
+	var parts [][]markdown.Block
+	ids := map[string]bool{}
+	for _, p := range paths {
+		blocks, err := readBlocks(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		title := blocks[0].(markdown.TitleBlock)
+		if title.Metadata.Author != "alice" || !reflect.DeepEqual(title.Metadata.Sources, []string{documentID(original)}) {
+			t.Errorf("%s: unexpected metadata %+v", p, title.Metadata)
+		}
+		ids[title.DocumentID] = true
+		parts = append(parts, blocks)
+	}
+	if len(ids) != 3 || ids[documentID(original)] {
+		t.Errorf("expected three new document IDs, got %v", ids)
+	}
+
+	setup := original[1:3]
+	if title := parts[0][0].(markdown.TitleBlock).Title; title != "Demo" || !reflect.DeepEqual(parts[0][1:], setup) {
+		t.Errorf("unexpected intro part %q: %+v", title, parts[0][1:])
+	}
+	want := append(append([]markdown.Block{}, setup...), original[4], original[5], markdown.HeadingBlock{Level: 2, Title: "Detail"})
+	if title := parts[1][0].(markdown.TitleBlock).Title; title != "First" || !reflect.DeepEqual(parts[1][1:], want) {
+		t.Errorf("unexpected part %q: %+v", title, parts[1][1:])
+	}
+	img := parts[2][len(parts[2])-1].(markdown.ImageOutputBlock)
+	if _, err := os.Stat(filepath.Join(dir, "parts", img.Filename)); err != nil {
+		t.Errorf("image not copied next to the part: %v", err)
+	}
+
+	if _, err := Split(file, "dev", SplitOptions{ByHeading: true, Dir: filepath.Join(dir, "parts")}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected an error when parts exist, got %v", err)
+	}
+}
+
+func TestSplitEvery(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Demo", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range []string{"a", "b", "c"} {
+		if _, _, err := Exec(file, "bash", "echo "+word, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Section(file, "End", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := Split(file, "dev", SplitOptions{Every: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("expected 2 parts, got %v", paths)
+	}
+	second, err := readBlocks(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := second[0].(markdown.TitleBlock).Title; title != "Demo (part 2 of 2)" {
+		t.Errorf("unexpected title %q", title)
+	}
+	if len(second) != 4 || second[1].(markdown.CodeBlock).Code != "echo c" {
+		t.Errorf("unexpected blocks: %+v", second)
+	}
+
+	if _, err := Split(file, "dev", SplitOptions{}); err == nil {
+		t.Error("expected an error without a split mode")
+	}
+}
+
+func TestSplitRemovesPartsOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Demo", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo a", ""); err != nil {
+		t.Fatal(err)
+	}
+	// The second part references an image that does not exist.
+	doc, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = append(doc, "\n```bash {image}\nchart.png\n```\n\n![chart](missing.png)\n"...)
+	if err := os.WriteFile(file, doc, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Split(file, "dev", SplitOptions{Every: 1}); err == nil || !strings.Contains(err.Error(), "image not found") {
+		t.Fatalf("expected the missing image to fail the split, got %v", err)
+	}
+	parts, _ := filepath.Glob(filepath.Join(dir, "demo-*.md"))
+	if len(parts) != 0 {
+		t.Errorf("expected no parts to remain, got %v", parts)
+	}
+}
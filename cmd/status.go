@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// VerifyStatus is the result of the most recent "verify" of a document,
+// recorded next to it so that exports and "info" can report it.
+type VerifyStatus struct {
+	Time    string `json:"time"`
+	Passed  bool   `json:"passed"`
+	Section string `json:"section,omitempty"`
+	// Failed lists the indexes of the blocks that did not match.
+	Failed []int `json:"failed,omitempty"`
+	// Digest is the SHA-256 of the document when it was verified.
+	Digest string `json:"digest"`
+}
+
+// Stale reports whether the document at file has changed since it was
+// verified.
+func (s VerifyStatus) Stale(file string) bool {
+	digest, err := documentDigest(file)
+	return err != nil || digest != s.Digest
+}
+
+// verifyStatusPath returns the path of the verify status of a document.
+func verifyStatusPath(file string) string {
+	return sidecarPath(file, "verify.json")
+}
+
+// documentDigest returns the hex SHA-256 of a document's content.
+func documentDigest(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("reading file: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// recordVerifyStatus records the outcome of verifying a document.
+func recordVerifyStatus(file, section string, diffs []Diff) error {
+	digest, err := documentDigest(file)
+	if err != nil {
+		return err
+	}
+	status := VerifyStatus{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Passed:  len(diffs) == 0,
+		Section: section,
+		Digest:  digest,
+	}
+	for _, d := range diffs {
+		status.Failed = append(status.Failed, d.BlockIndex)
+	}
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(verifyStatusPath(file), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing verify status: %w", err)
+	}
+	return nil
+}
+
+// LastVerify returns the result of the most recent "verify" of a document,
+// or nil if it has not been verified.
+func LastVerify(file string) (*VerifyStatus, error) {
+	data, err := os.ReadFile(verifyStatusPath(file))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading verify status: %w", err)
+	}
+	var status VerifyStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("parsing verify status: %w", err)
+	}
+	return &status, nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLastVerify(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := LastVerify(file); err != nil || status != nil {
+		t.Fatalf("expected no status before verify, got %+v, %v", status, err)
+	}
+
+	if _, _, err := Exec(file, "bash", "echo ok", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(file, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	status, err := LastVerify(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status == nil || !status.Passed || status.Failed != nil || status.Stale(file) {
+		t.Fatalf("expected a fresh passing status, got %+v", status)
+	}
+
+	if _, _, err := Exec(file, "bash", "date +%s%N", ""); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Stale(file) {
+		t.Error("expected the status to be stale after the document changed")
+	}
+	if _, err := Verify(file, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	status, err = LastVerify(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Passed || !reflect.DeepEqual(status.Failed, []int{3}) {
+		t.Errorf("expected block 3 to fail, got %+v", status)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".demo.md.verify.json")); err != nil {
+		t.Errorf("expected status sidecar: %v", err)
+	}
+}
+
+func TestVerifyStatusWriteFailureIsNotFatal(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo ok", ""); err != nil {
+		t.Fatal(err)
+	}
+	// A directory in the way makes the status impossible to write.
+	if err := os.Mkdir(verifyStatusPath(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := Verify(file, "", "")
+	if err != nil {
+		t.Fatalf("expected verify to pass without recording its status, got %v", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected no diffs, got %+v", diffs)
+	}
+}
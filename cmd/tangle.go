@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// tangleLanguages maps code block languages to the file extension and line
+// comment prefix of the files Tangle writes for them. Languages that share
+// an extension share a file.
+var tangleLanguages = map[string]struct{ ext, comment string }{
+	"bash":       {".sh", "#"},
+	"sh":         {".sh", "#"},
+	"shell":      {".sh", "#"},
+	"zsh":        {".zsh", "#"},
+	"python":     {".py", "#"},
+	"python3":    {".py", "#"},
+	"ruby":       {".rb", "#"},
+	"perl":       {".pl", "#"},
+	"r":          {".r", "#"},
+	"javascript": {".js", "//"},
+	"js":         {".js", "//"},
+	"node":       {".js", "//"},
+	"typescript": {".ts", "//"},
+	"ts":         {".ts", "//"},
+	"go":         {".go", "//"},
+	"rust":       {".rs", "//"},
+	"java":       {".java", "//"},
+	"c":          {".c", "//"},
+	"cpp":        {".cpp", "//"},
+	"c++":        {".cpp", "//"},
+	"php":        {".php", "//"},
+	"swift":      {".swift", "//"},
+	"sql":        {".sql", "--"},
+	"sqlite3":    {".sql", "--"},
+	"lua":        {".lua", "--"},
+	"haskell":    {".hs", "--"},
+}
+
+// markdownLanguages are languages whose name would give a tangled file the
+// extension of the document itself, so they are tangled to .txt instead.
+var markdownLanguages = map[string]bool{
+	"md":       true,
+	"markdown": true,
+	"mdx":      true,
+	"rmd":      true,
+	"qmd":      true,
+}
+
+// tangleFile returns the extension and comment prefix for a language.
+// Unknown languages use the language name as the extension and "#"
+// comments, except markdown, which uses ".txt".
+func tangleFile(lang string) (ext, comment string) {
+	if l, ok := tangleLanguages[strings.ToLower(lang)]; ok {
+		return l.ext, l.comment
+	}
+	if markdownLanguages[strings.ToLower(lang)] {
+		return ".txt", "#"
+	}
+	var sb strings.Builder
+	for _, r := range strings.ToLower(lang) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			sb.WriteRune(r)
+		}
+	}
+	if sb.Len() == 0 {
+		return ".txt", "#"
+	}
+	return "." + sb.String(), "#"
+}
+
+// Tangle writes the code of a showboat document to plain source files in
+// dir, one per language, in the style of literate programming. Each file is
+// named after the document (demo.md gives demo.sh, demo.py and so on) and
+// holds that language's code blocks in document order, each preceded by a
+// comment giving the document line it starts on. Scripts added with "image
+// --run" are included; image references and outputs are not. A section is
+// tangled with the setup blocks ahead of it, and an empty section tangles
+// the whole document. A file that would replace the document itself is
+// refused before anything is written. Returns the paths of the files
+// written.
+func Tangle(file, dir, section string) ([]string, error) {
+	_, blocks, spans, err := readSource(file)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := sectionRange(blocks, section)
+	if err != nil {
+		return nil, err
+	}
+
+	docName := filepath.Base(file)
+	base := strings.TrimSuffix(docName, filepath.Ext(docName))
+	var order []string
+	contents := map[string]*strings.Builder{}
+	for i := range end {
+		cb, ok := blocks[i].(markdown.CodeBlock)
+		if !ok || (cb.IsImage && !cb.Run) || !inSection(blocks, i, start, end) {
+			continue
+		}
+		ext, comment := tangleFile(cb.Lang)
+		sb, ok := contents[ext]
+		if !ok {
+			sb = &strings.Builder{}
+			fmt.Fprintf(sb, "%s Tangled from %s by showboat.\n", comment, docName)
+			contents[ext] = sb
+			order = append(order, ext)
+		}
+		label := fmt.Sprintf("%s:%d", docName, spans[i].Start+1)
+		switch {
+		case cb.Setup:
+			label += " (setup)"
+		case cb.IsImage:
+			label += " (image script)"
+		}
+		fmt.Fprintf(sb, "\n%s %s\n%s\n", comment, label, strings.TrimSuffix(cb.Code, "\n"))
+	}
+
+	for _, ext := range order {
+		if path := filepath.Join(dir, base+ext); sameFile(path, file) {
+			return nil, fmt.Errorf("tangling would overwrite the document: %s", path)
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating directory: %w", err)
+	}
+	var written []string
+	for _, ext := range order {
+		path := filepath.Join(dir, base+ext)
+		if err := os.WriteFile(path, []byte(contents[ext].String()), 0644); err != nil {
+			return written, fmt.Errorf("writing %s: %w", path, err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
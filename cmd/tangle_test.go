@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestTangle(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecBlock(file, markdown.CodeBlock{Lang: "bash", Code: "echo setup", Setup: true}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "python3", "print('hi')", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "sh", "echo two", ""); err != nil {
+		t.Fatal(err)
+	}
+	// Line numbers come from the file as written, not as Write would
+	// produce it.
+	doc, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = []byte(strings.Replace(string(doc), "\n```python3", "\n\n\n\n```python3", 1))
+	if err := os.WriteFile(file, doc, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "src")
+	written, err := Tangle(file, out, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 2 || filepath.Base(written[0]) != "demo.sh" || filepath.Base(written[1]) != "demo.py" {
+		t.Fatalf("expected demo.sh and demo.py, got %v", written)
+	}
+
+	sh, err := os.ReadFile(written[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	docLines := strings.Split(string(doc), "\n")
+	lineOf := func(text string) int {
+		for i, l := range docLines {
+			if l == text {
+				return i + 1
+			}
+		}
+		t.Fatalf("%q not found in document", text)
+		return 0
+	}
+
+	want := "# Tangled from demo.md by showboat.\n\n" +
+		"# demo.md:" + strconv.Itoa(lineOf("echo setup")) + " (setup)\necho setup\n\n" +
+		"# demo.md:" + strconv.Itoa(lineOf("echo two")) + "\necho two\n"
+	if string(sh) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, sh)
+	}
+
+	py, err := os.ReadFile(written[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(py), "# demo.md:"+strconv.Itoa(lineOf("print('hi')"))+"\nprint('hi')\n") {
+		t.Errorf("unexpected python file:\n%s", py)
+	}
+}
+
+func TestTangleFile(t *testing.T) {
+	tests := []struct{ lang, ext, comment string }{
+		{"bash", ".sh", "#"},
+		{"JavaScript", ".js", "//"},
+		{"sql", ".sql", "--"},
+		{"elixir", ".elixir", "#"},
+		{"???", ".txt", "#"},
+		{"md", ".txt", "#"},
+		{"Markdown", ".txt", "#"},
+	}
+	for _, tt := range tests {
+		ext, comment := tangleFile(tt.lang)
+		if ext != tt.ext || comment != tt.comment {
+			t.Errorf("tangleFile(%q) = %q, %q; want %q, %q", tt.lang, ext, comment, tt.ext, tt.comment)
+		}
+	}
+}
+
+func TestTangleRefusesToOverwriteDocument(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.sh")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hi", ""); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Tangle(file, dir, ""); err == nil || !strings.Contains(err.Error(), "overwrite the document") {
+		t.Errorf("expected tangling over the document to be refused, got %v", err)
+	}
+	after, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("expected the document to be unchanged, got:\n%s", after)
+	}
+}
@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	execpkg "github.com/simonw/showboat/exec"
@@ -13,61 +18,291 @@ type Diff struct {
 	BlockIndex int
 	Expected   string
 	Actual     string
+	// Mismatch is set when the output did not match the recorded output
+	// under Mode. With a match mode other than exact, the two may be equal.
+	Mismatch bool
+	// ExpectedExit describes the exit code the block was expected to return
+	// ("2" or "non-zero"). It is only set when that expectation failed.
+	ExpectedExit string
+	ActualExit   int
+	// Mode is the match mode the outputs were compared with; empty means
+	// an exact comparison.
+	Mode string
+	// Problem describes a failure that is not an output mismatch, such as
+	// an image script that no longer produces an image.
+	Problem string
 }
 
 // String returns a human-readable description of the diff.
 func (d Diff) String() string {
-	return fmt.Sprintf("block %d:\n  expected: %s\n  actual:   %s",
-		d.BlockIndex,
-		strings.TrimRight(d.Expected, "\n"),
-		strings.TrimRight(d.Actual, "\n"),
-	)
+	if d.Problem != "" {
+		return fmt.Sprintf("block %d: %s", d.BlockIndex, d.Problem)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "block %d:", d.BlockIndex)
+	if d.Mismatch || d.ExpectedExit == "" {
+		label := expectedLabel(d.Mode) + ":"
+		fmt.Fprintf(&sb, "\n  %s %s\n  %-*s %s",
+			label,
+			strings.TrimRight(d.Expected, "\n"),
+			len(label), "actual:",
+			strings.TrimRight(d.Actual, "\n"),
+		)
+		if d.Mode == markdown.MatchLinesUnordered {
+			missing, extra := lineDifferences(d.Expected, d.Actual)
+			if len(missing) > 0 {
+				fmt.Fprintf(&sb, "\n  missing lines: %q", missing)
+			}
+			if len(extra) > 0 {
+				fmt.Fprintf(&sb, "\n  extra lines:   %q", extra)
+			}
+		}
+	}
+	if d.ExpectedExit != "" {
+		fmt.Fprintf(&sb, "\n  expected exit code: %s\n  actual exit code:   %d", d.ExpectedExit, d.ActualExit)
+	}
+	return sb.String()
+}
+
+// ExitCodeMatches reports whether exitCode satisfies the exit code
+// expectation of cb. Blocks without an expectation accept any exit code.
+func ExitCodeMatches(cb markdown.CodeBlock, exitCode int) bool {
+	switch {
+	case cb.ExpectExit != 0:
+		return exitCode == cb.ExpectExit
+	case cb.ExpectFailure:
+		return exitCode != 0
+	}
+	return true
 }
 
+// DescribeExpectedExit describes the exit code expectation of cb, e.g. "2"
+// or "non-zero".
+func DescribeExpectedExit(cb markdown.CodeBlock) string {
+	if cb.ExpectExit != 0 {
+		return strconv.Itoa(cb.ExpectExit)
+	}
+	return "non-zero"
+}
+
+// VerifyOptions controls how Verify re-executes a document.
+type VerifyOptions struct {
+	// OutputFile, if non-empty, receives an updated copy of the document.
+	OutputFile string
+	// Workdir, if non-empty, is the directory code blocks are executed in.
+	Workdir string
+	// Section, if non-empty, limits verification to the code blocks in the
+	// section with that heading.
+	Section string
+	// ImageThreshold is the largest perceptual difference (0 to 1) allowed
+	// between a recorded image and its re-generated version. Nil means
+	// DefaultImageThreshold; zero allows no visible change.
+	ImageThreshold *float64
+}
+
+// DefaultImageThreshold is the image difference tolerated by default: enough
+// to absorb anti-aliasing and compression noise in screenshots.
+const DefaultImageThreshold = 0.01
+
 // Verify re-executes all code blocks and compares outputs.
 // If outputFile is non-empty, an updated copy of the document is written there.
 // If workdir is non-empty, code blocks are executed in that directory.
 func Verify(file, outputFile, workdir string) ([]Diff, error) {
+	return VerifyWithOptions(file, VerifyOptions{OutputFile: outputFile, Workdir: workdir})
+}
+
+// VerifyWithOptions re-executes the code blocks of a document as configured
+// by opts and compares outputs. The outcome is recorded next to the document
+// (see LastVerify).
+func VerifyWithOptions(file string, opts VerifyOptions) ([]Diff, error) {
 	blocks, err := readBlocks(file)
 	if err != nil {
 		return nil, err
 	}
 
+	start, end, err := sectionRange(blocks, opts.Section)
+	if err != nil {
+		return nil, err
+	}
+	workdir := opts.Workdir
+
 	var diffs []Diff
 
-	for i := 0; i < len(blocks); i++ {
+	for i := 0; i < end; i++ {
 		cb, ok := blocks[i].(markdown.CodeBlock)
-		if !ok || cb.IsImage {
+		if !ok || (cb.IsImage && !cb.Run) {
+			continue
+		}
+		// Setup blocks ahead of the selected section still run, since the
+		// section may depend on them.
+		if i < start && !cb.Setup {
+			continue
+		}
+
+		if cb.IsImage {
+			diff, err := verifyImage(file, blocks, i, opts)
+			if err != nil {
+				return nil, err
+			}
+			if diff != nil {
+				diffs = append(diffs, *diff)
+			}
 			continue
 		}
 
 		// Execute the code block
-		output, _, err := execpkg.Run(cb.Lang, cb.Code, workdir)
+		output, exitCode, err := execpkg.Run(cb.Lang, cb.Code, workdir)
 		if err != nil {
 			return nil, fmt.Errorf("executing block %d: %w", i, err)
 		}
 
+		diff := Diff{BlockIndex: i, Expected: output, Actual: output, Mode: cb.Match}
+		if !ExitCodeMatches(cb, exitCode) {
+			diff.ExpectedExit = DescribeExpectedExit(cb)
+			diff.ActualExit = exitCode
+		}
+
 		// Check if next block is an OutputBlock
 		if i+1 < len(blocks) {
 			if ob, ok := blocks[i+1].(markdown.OutputBlock); ok {
-				if ob.Content != output {
-					diffs = append(diffs, Diff{
-						BlockIndex: i,
-						Expected:   ob.Content,
-						Actual:     output,
-					})
-					// Update the block for the output copy
-					blocks[i+1] = markdown.OutputBlock{Content: output}
+				matched, err := matchOutput(cb.Match, ob.Content, output)
+				if err != nil {
+					// Recorded output that cannot be used for the match
+					// mode fails this block, not the whole verify.
+					diff.Problem = err.Error()
+				}
+				if !matched {
+					diff.Expected = ob.Content
+					diff.Mismatch = true
+					// Update the block for the output copy. Output recorded
+					// for another match mode was written by hand, such as a
+					// pattern, so it is reported but kept.
+					if cb.Match == "" || cb.Match == markdown.MatchExact {
+						blocks[i+1] = markdown.OutputBlock{Content: output}
+					}
 				}
 			}
 		}
+		if diff.Mismatch || diff.ExpectedExit != "" {
+			diffs = append(diffs, diff)
+		}
 	}
 
-	if outputFile != "" {
-		if err := writeBlocks(outputFile, blocks); err != nil {
+	// The status is a convenience for "status" and "info"; failing to
+	// record it, as in a read-only checkout, does not fail the verify.
+	if err := recordVerifyStatus(file, opts.Section, diffs); err != nil {
+		fmt.Fprintf(os.Stderr, "showboat: verify status warning: %v\n", err)
+	}
+
+	if opts.OutputFile != "" {
+		if err := writeVerifyOutput(opts.OutputFile, blocks); err != nil {
 			return diffs, fmt.Errorf("writing output file: %w", err)
 		}
 	}
 
 	return diffs, nil
 }
+
+// writeVerifyOutput writes the updated blocks to output, holding its lock if
+// it is an existing document that other commands may be changing.
+func writeVerifyOutput(output string, blocks []markdown.Block) error {
+	if _, err := os.Stat(output); err == nil {
+		unlock, err := lockDocument(output)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	return writeBlocks(output, blocks)
+}
+
+// verifyImage re-runs the image script of blocks[i] and checks that it still
+// produces an image that looks like the recorded one. When the perceptual
+// difference exceeds the threshold a diff image is written next to the
+// document. When opts.OutputFile is set a changed image is copied next to it
+// and the following ImageOutputBlock is updated to reference it.
+func verifyImage(file string, blocks []markdown.Block, i int, opts VerifyOptions) (*Diff, error) {
+	cb := blocks[i].(markdown.CodeBlock)
+
+	tmp, err := os.MkdirTemp("", "showboat-verify-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	filename, err := execpkg.RunImage(cb.Code, tmp, opts.Workdir)
+	if err != nil {
+		return &Diff{BlockIndex: i, Problem: fmt.Sprintf("image script did not produce an image: %v", err)}, nil
+	}
+	newPath := filepath.Join(tmp, filename)
+
+	var img markdown.ImageOutputBlock
+	hasRecorded := false
+	if i+1 < len(blocks) {
+		img, hasRecorded = blocks[i+1].(markdown.ImageOutputBlock)
+	}
+	if !hasRecorded {
+		return nil, nil
+	}
+
+	var diff *Diff
+	recordedPath := filepath.Join(filepath.Dir(file), filepath.FromSlash(img.Filename))
+	if _, err := os.Stat(recordedPath); err != nil {
+		diff = &Diff{BlockIndex: i, Problem: fmt.Sprintf("recorded image not found: %s", img.Filename)}
+	} else if problem, err := compareImage(file, i, recordedPath, newPath, opts); err != nil {
+		return nil, err
+	} else if problem != "" {
+		diff = &Diff{BlockIndex: i, Problem: problem}
+	}
+
+	if diff != nil && opts.OutputFile != "" {
+		destDir, prefix, err := assetDir(opts.OutputFile, blocks)
+		if err != nil {
+			return nil, err
+		}
+		newFilename, err := execpkg.CopyImageWithOptions(newPath, destDir, blockImageOptions(cb).copyOptions(blocks))
+		if err != nil {
+			return nil, err
+		}
+		img.Filename = path.Join(prefix, newFilename)
+		blocks[i+1] = img
+	}
+	return diff, nil
+}
+
+// compareImage compares the recorded image with a newly generated one and
+// describes the difference, or returns "" if they match. Images that cannot
+// be decoded, such as SVG, must be byte-for-byte identical.
+func compareImage(file string, i int, recordedPath, newPath string, opts VerifyOptions) (string, error) {
+	threshold := DefaultImageThreshold
+	if opts.ImageThreshold != nil {
+		threshold = *opts.ImageThreshold
+	}
+
+	score, diffImg, err := execpkg.CompareImages(recordedPath, newPath)
+	if err != nil {
+		recorded, rerr := os.ReadFile(recordedPath)
+		if rerr != nil {
+			return "", fmt.Errorf("reading recorded image: %w", rerr)
+		}
+		generated, gerr := os.ReadFile(newPath)
+		if gerr != nil {
+			return "", fmt.Errorf("reading generated image: %w", gerr)
+		}
+		if !bytes.Equal(recorded, generated) {
+			return "image changed (not comparable perceptually, so compared bytes)", nil
+		}
+		return "", nil
+	}
+	if score <= threshold {
+		return "", nil
+	}
+
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	diffPath := filepath.Join(filepath.Dir(file), fmt.Sprintf("%s-block-%d-diff.png", base, i))
+	if err := execpkg.WriteDiffImage(diffImg, diffPath); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("image differs by %.2f%% (threshold %.2f%%); diff written to %s",
+		score*100, threshold*100, diffPath), nil
+}
@@ -1,10 +1,15 @@
 package cmd
 
 import (
+	"image"
+	"image/color"
+	"image/png"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/simonw/showboat/markdown"
 )
 
 func TestVerifyPasses(t *testing.T) {
@@ -120,3 +125,231 @@ func TestVerifyWritesOutput(t *testing.T) {
 		t.Errorf("output file should not contain tampered output, got: %s", updatedContent)
 	}
 }
+
+func TestVerifyExpectedExit(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	work := t.TempDir()
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	block := markdown.CodeBlock{Lang: "bash", Code: "cat config.txt", ExpectExit: 1}
+	if _, exitCode, err := ExecBlock(file, block, work); err != nil {
+		t.Fatal(err)
+	} else if exitCode != 1 {
+		t.Fatalf("expected exit code 1, got %d", exitCode)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "```bash {expect-exit=1}\ncat config.txt\n```") {
+		t.Errorf("expected exit attribute in document, got: %s", content)
+	}
+
+	diffs, err := Verify(file, "", work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected no diffs, got %v", diffs)
+	}
+
+	// Once the file exists the command succeeds, which breaks the expectation
+	// even though the output is also different.
+	if err := os.WriteFile(filepath.Join(work, "config.txt"), []byte("ok\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err = Verify(file, "", work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 {
+		t.Fatalf("expected 1 diff, got %d", len(diffs))
+	}
+	if diffs[0].ExpectedExit != "1" || diffs[0].ActualExit != 0 {
+		t.Errorf("unexpected exit diff: %+v", diffs[0])
+	}
+	if !strings.Contains(diffs[0].String(), "expected exit code: 1") {
+		t.Errorf("expected exit code in message, got: %s", diffs[0].String())
+	}
+}
+
+func TestExitCodeMatches(t *testing.T) {
+	tests := []struct {
+		block    markdown.CodeBlock
+		exitCode int
+		want     bool
+	}{
+		{markdown.CodeBlock{}, 3, true},
+		{markdown.CodeBlock{ExpectExit: 2}, 2, true},
+		{markdown.CodeBlock{ExpectExit: 2}, 1, false},
+		{markdown.CodeBlock{ExpectFailure: true}, 1, true},
+		{markdown.CodeBlock{ExpectFailure: true}, 0, false},
+	}
+	for _, tt := range tests {
+		if got := ExitCodeMatches(tt.block, tt.exitCode); got != tt.want {
+			t.Errorf("ExitCodeMatches(%+v, %d) = %v, want %v", tt.block, tt.exitCode, got, tt.want)
+		}
+	}
+}
+
+func TestExecRejectsInvalidExpectExit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	block := markdown.CodeBlock{Lang: "bash", Code: "exit 1", ExpectExit: 256}
+	if _, _, err := ExecBlock(file, block, ""); err == nil || !strings.Contains(err.Error(), "must be 1 to 255") {
+		t.Errorf("expected an out of range exit code to be rejected, got %v", err)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 {
+		t.Errorf("expected nothing to be recorded, got %+v", blocks)
+	}
+}
+
+func TestVerifyReRunsImageScripts(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	work := t.TempDir()
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(work, "source.png"), minimalPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := "cp source.png chart.png && echo chart.png"
+	if err := ImageWithOptions(file, script, work, ImageOptions{Run: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := Verify(file, "", work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected no diffs, got %v", diffs)
+	}
+
+	// Without its input the script no longer produces an image.
+	if err := os.Remove(filepath.Join(work, "source.png")); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err = Verify(file, "", work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 {
+		t.Fatalf("expected 1 diff, got %d", len(diffs))
+	}
+	if !strings.Contains(diffs[0].String(), "image script did not produce an image") {
+		t.Errorf("unexpected diff message: %s", diffs[0].String())
+	}
+}
+
+func TestVerifyImageDifferenceWritesDiff(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	work := t.TempDir()
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	writePixelPNG(t, filepath.Join(work, "source.png"), color.White)
+	script := "cp source.png chart.png && echo chart.png"
+	if err := ImageWithOptions(file, script, work, ImageOptions{Run: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the source with a black pixel: a 100% difference.
+	writePixelPNG(t, filepath.Join(work, "source.png"), color.Black)
+
+	outputFile := filepath.Join(dir, "updated.md")
+	diffs, err := VerifyWithOptions(file, VerifyOptions{Workdir: work, OutputFile: outputFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 {
+		t.Fatalf("expected 1 diff, got %d", len(diffs))
+	}
+	if !strings.Contains(diffs[0].Problem, "image differs by 100.00%") {
+		t.Errorf("unexpected diff: %s", diffs[0].String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "demo-block-1-diff.png")); err != nil {
+		t.Errorf("expected diff image next to document: %v", err)
+	}
+
+	// The updated copy references a new image file.
+	original, _ := readBlocks(file)
+	updated, err := readBlocks(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldImg := original[2].(markdown.ImageOutputBlock)
+	newImg := updated[2].(markdown.ImageOutputBlock)
+	if oldImg.Filename == newImg.Filename {
+		t.Errorf("expected updated copy to reference the new image")
+	}
+
+	// A generous threshold accepts the change.
+	generous := 1.0
+	diffs, err = VerifyWithOptions(file, VerifyOptions{Workdir: work, ImageThreshold: &generous})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected no diffs with threshold 1, got %v", diffs)
+	}
+}
+
+// writePixelPNG writes a decodable 1x1 PNG of the given color.
+func TestVerifyImageThresholdZero(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.md")
+	work := t.TempDir()
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	writePixelPNG(t, filepath.Join(work, "source.png"), color.White)
+	if err := ImageWithOptions(file, "cp source.png chart.png && echo chart.png", work, ImageOptions{Run: true}); err != nil {
+		t.Fatal(err)
+	}
+	// A change too small for the default threshold.
+	writePixelPNG(t, filepath.Join(work, "source.png"), color.Gray{Y: 254})
+
+	diffs, err := VerifyWithOptions(file, VerifyOptions{Workdir: work})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected the default threshold to pass, got %v", diffs)
+	}
+	exact := 0.0
+	diffs, err = VerifyWithOptions(file, VerifyOptions{Workdir: work, ImageThreshold: &exact})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 {
+		t.Errorf("expected threshold 0 to fail, got %v", diffs)
+	}
+}
+
+func writePixelPNG(t *testing.T, path string, c color.Color) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, c)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
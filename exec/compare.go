@@ -0,0 +1,172 @@
+package exec
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"  // register GIF decoder
+	_ "image/jpeg" // register JPEG decoder
+	"image/png"
+	"math"
+	"os"
+)
+
+// compareGrid is the side length of the grid both images are averaged down
+// to before comparison, which makes the comparison tolerant of scaling and
+// tiny rendering differences.
+const compareGrid = 64
+
+// pixelTolerance is the luminance difference (0-255) below which a pixel is
+// not highlighted in a diff image.
+const pixelTolerance = 24
+
+// CompareImages decodes the images at pathA and pathB and returns their
+// perceptual difference: 0 for identical images up to 1 for completely
+// different ones. The difference is the larger of the mean difference of
+// the two images averaged down to a grid and, for images of the same size,
+// the fraction of pixels that visibly changed. Both measure how much of the
+// image changed, so a change to a small area, such as a word of text in a
+// large screenshot, gives a small difference. It also returns a diff image
+// the size of image B in which changed pixels are highlighted in red. An
+// error is returned if either image cannot be decoded (for example SVG).
+func CompareImages(pathA, pathB string) (float64, image.Image, error) {
+	a, err := decodeImage(pathA)
+	if err != nil {
+		return 0, nil, err
+	}
+	b, err := decodeImage(pathB)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	gridA := luminanceGrid(a)
+	gridB := luminanceGrid(b)
+	var total float64
+	for i := range gridA {
+		total += math.Abs(gridA[i] - gridB[i])
+	}
+	diff := total / float64(len(gridA)) / 255
+	if a.Bounds().Size() == b.Bounds().Size() {
+		diff = math.Max(diff, changedFraction(a, b))
+	}
+
+	// A change in aspect ratio is a real difference even if the averaged
+	// content happens to be similar.
+	ra := float64(a.Bounds().Dx()) / float64(a.Bounds().Dy())
+	rb := float64(b.Bounds().Dx()) / float64(b.Bounds().Dy())
+	if math.Abs(ra-rb) > 0.01 {
+		diff = math.Max(diff, math.Min(1, math.Abs(ra-rb)/math.Max(ra, rb)))
+	}
+
+	return diff, diffImage(a, b), nil
+}
+
+// WriteDiffImage writes img as a PNG file at path.
+func WriteDiffImage(img image.Image, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating diff image: %w", err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		return fmt.Errorf("encoding diff image: %w", err)
+	}
+	return nil
+}
+
+// decodeImage opens and decodes an image file.
+func decodeImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening image: %w", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	if img.Bounds().Empty() {
+		return nil, fmt.Errorf("decoding %s: image is empty", path)
+	}
+	return img, nil
+}
+
+// luminanceGrid averages the luminance of img over a compareGrid x
+// compareGrid grid of cells.
+func luminanceGrid(img image.Image) []float64 {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	sums := make([]float64, compareGrid*compareGrid)
+	counts := make([]float64, compareGrid*compareGrid)
+	for y := 0; y < h; y++ {
+		cy := y * compareGrid / h
+		for x := 0; x < w; x++ {
+			cx := x * compareGrid / w
+			sums[cy*compareGrid+cx] += luminance(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+			counts[cy*compareGrid+cx]++
+		}
+	}
+	// Images smaller than the grid leave some cells empty; fill them from
+	// the nearest source pixel so both grids stay comparable.
+	for cy := 0; cy < compareGrid; cy++ {
+		for cx := 0; cx < compareGrid; cx++ {
+			i := cy*compareGrid + cx
+			if counts[i] == 0 {
+				x := bounds.Min.X + cx*w/compareGrid
+				y := bounds.Min.Y + cy*h/compareGrid
+				sums[i] = luminance(img.At(x, y))
+				counts[i] = 1
+			}
+			sums[i] /= counts[i]
+		}
+	}
+	return sums
+}
+
+// changedFraction returns the fraction of pixels whose luminance differs by
+// more than pixelTolerance between two images of the same size.
+func changedFraction(a, b image.Image) float64 {
+	ab, bb := a.Bounds(), b.Bounds()
+	changed := 0
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			la := luminance(a.At(ab.Min.X+x, ab.Min.Y+y))
+			lb := luminance(b.At(bb.Min.X+x, bb.Min.Y+y))
+			if math.Abs(la-lb) > pixelTolerance {
+				changed++
+			}
+		}
+	}
+	return float64(changed) / float64(ab.Dx()*ab.Dy())
+}
+
+// luminance returns the perceived brightness (0-255) of c, composited onto
+// a white background.
+func luminance(c color.Color) float64 {
+	r, g, b, a := c.RGBA()
+	white := float64(0xffff - a)
+	lum := 0.299*(float64(r)+white) + 0.587*(float64(g)+white) + 0.114*(float64(b)+white)
+	return lum / 0xffff * 255
+}
+
+// diffImage renders image b faded to grey, with pixels that differ from the
+// corresponding (scaled) pixel of image a highlighted in red.
+func diffImage(a, b image.Image) image.Image {
+	ab, bb := a.Bounds(), b.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, bb.Dx(), bb.Dy()))
+	red := color.RGBA{R: 255, A: 255}
+	for y := 0; y < bb.Dy(); y++ {
+		ay := ab.Min.Y + y*ab.Dy()/bb.Dy()
+		for x := 0; x < bb.Dx(); x++ {
+			ax := ab.Min.X + x*ab.Dx()/bb.Dx()
+			lb := luminance(b.At(bb.Min.X+x, bb.Min.Y+y))
+			if math.Abs(luminance(a.At(ax, ay))-lb) > pixelTolerance {
+				out.Set(x, y, red)
+				continue
+			}
+			grey := uint8(191 + lb/4)
+			out.Set(x, y, color.RGBA{R: grey, G: grey, B: grey, A: 255})
+		}
+	}
+	return out
+}
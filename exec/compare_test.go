@@ -0,0 +1,140 @@
+package exec
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestPNG writes a w x h PNG filled with bg, with an optional square of
+// fg in the top-left quarter.
+func writeTestPNG(t *testing.T, path string, w, h int, bg, fg color.Color) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := bg
+			if fg != nil && x < w/2 && y < h/2 {
+				c = fg
+			}
+			img.Set(x, y, c)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompareImagesIdentical(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.png")
+	b := filepath.Join(dir, "b.png")
+	writeTestPNG(t, a, 100, 80, color.White, color.Black)
+	writeTestPNG(t, b, 100, 80, color.White, color.Black)
+
+	score, diff, err := CompareImages(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score != 0 {
+		t.Errorf("expected score 0, got %f", score)
+	}
+	if diff.Bounds().Dx() != 100 || diff.Bounds().Dy() != 80 {
+		t.Errorf("unexpected diff image size: %v", diff.Bounds())
+	}
+}
+
+func TestCompareImagesScaled(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.png")
+	b := filepath.Join(dir, "b.png")
+	writeTestPNG(t, a, 100, 80, color.White, color.Black)
+	writeTestPNG(t, b, 200, 160, color.White, color.Black)
+
+	score, _, err := CompareImages(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score > 0.01 {
+		t.Errorf("expected a retina-scaled copy to match, got score %f", score)
+	}
+}
+
+func TestCompareImagesDifferent(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.png")
+	b := filepath.Join(dir, "b.png")
+	writeTestPNG(t, a, 100, 80, color.White, nil)
+	writeTestPNG(t, b, 100, 80, color.White, color.Black)
+
+	score, diff, err := CompareImages(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A black quarter on white changes a quarter of the image completely.
+	if score < 0.2 || score > 0.3 {
+		t.Errorf("expected score around 0.25, got %f", score)
+	}
+	r, g, _, _ := diff.At(10, 10).RGBA()
+	if r != 0xffff || g != 0 {
+		t.Errorf("expected changed pixel to be red in diff image")
+	}
+	r, g, _, _ = diff.At(90, 70).RGBA()
+	if g == 0 {
+		t.Errorf("expected unchanged pixel to be grey in diff image")
+	}
+}
+
+func TestCompareImagesUndecodable(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.svg")
+	if err := os.WriteFile(a, []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := CompareImages(a, a); err == nil {
+		t.Error("expected error for SVG")
+	}
+}
+
+func TestCompareImagesSameSizeComparesPixels(t *testing.T) {
+	// Shifting a checkerboard by one pixel keeps every averaged grid cell
+	// the same, but changes every pixel.
+	dir := t.TempDir()
+	write := func(name string, shift int) string {
+		img := image.NewGray(image.Rect(0, 0, 128, 128))
+		for y := 0; y < 128; y++ {
+			for x := 0; x < 128; x++ {
+				if (x+y+shift)%2 == 0 {
+					img.SetGray(x, y, color.Gray{Y: 255})
+				}
+			}
+		}
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	a, b := write("a.png", 0), write("b.png", 1)
+
+	score, _, err := CompareImages(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score != 1 {
+		t.Errorf("expected every pixel to count as changed, got score %f", score)
+	}
+}
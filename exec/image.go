@@ -1,8 +1,11 @@
 package exec
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,20 +14,50 @@ import (
 	"github.com/google/uuid"
 )
 
-// validImageExts lists recognized image file extensions.
-var validImageExts = map[string]bool{
-	".png":  true,
-	".jpg":  true,
-	".jpeg": true,
-	".gif":  true,
-	".svg":  true,
+// validImageExts maps recognized image file extensions to the canonical
+// extension of the format they denote.
+var validImageExts = map[string]string{
+	".png":  ".png",
+	".jpg":  ".jpg",
+	".jpeg": ".jpg",
+	".gif":  ".gif",
+	".svg":  ".svg",
+	".webp": ".webp",
+	".avif": ".avif",
+	".bmp":  ".bmp",
+}
+
+// CopyOptions controls how images are stored by CopyImageWithOptions and
+// RunImageWithOptions.
+type CopyOptions struct {
+	// ContentHash names the image after a hash of its content instead of
+	// a random <uuid>-<date> name, so identical images share one file.
+	ContentHash bool
+	// MaxWidth scales PNG and JPEG images wider than this many pixels down
+	// to this width. Zero leaves the size unchanged.
+	MaxWidth int
+	// Quality re-encodes PNG and JPEG images, at this JPEG quality (1-100).
+	// PNG images are re-encoded losslessly. Zero re-encodes only images
+	// that are resized.
+	Quality int
+	// Strip removes EXIF, XMP and text metadata from PNG and JPEG images.
+	Strip bool
 }
 
 // CopyImage copies an image file to destDir with a generated
 // <uuid>-<date>.<ext> filename. It validates that srcPath exists, is a
-// regular file, and has a recognized image extension.
+// regular file, and contains a recognized image format. The format is
+// detected from the file content: a file whose extension does not match its
+// content is rejected, and a file without an extension is given the
+// extension of its detected format.
 // Returns the new filename (not the full path).
 func CopyImage(srcPath, destDir string) (string, error) {
+	return CopyImageWithOptions(srcPath, destDir, CopyOptions{})
+}
+
+// CopyImageWithOptions is like CopyImage but names and processes the copy as
+// configured by opts.
+func CopyImageWithOptions(srcPath, destDir string, opts CopyOptions) (string, error) {
 	// Verify file exists
 	info, err := os.Stat(srcPath)
 	if err != nil {
@@ -34,43 +67,186 @@ func CopyImage(srcPath, destDir string) (string, error) {
 		return "", fmt.Errorf("image path is a directory: %s", srcPath)
 	}
 
-	// Check extension
-	ext := strings.ToLower(filepath.Ext(srcPath))
-	if !validImageExts[ext] {
-		return "", fmt.Errorf("unrecognized image format: %s", ext)
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return "", fmt.Errorf("reading image: %w", err)
 	}
 
-	// Generate destination filename
-	id := uuid.New().String()[:8]
-	date := time.Now().UTC().Format("2006-01-02")
-	newFilename := fmt.Sprintf("%s-%s%s", id, date, ext)
+	// Check content against extension
+	detected := DetectImageFormat(data)
+	ext := strings.ToLower(filepath.Ext(srcPath))
+	if detected == "" {
+		if ext != "" {
+			return "", unrecognizedImage(data, ext)
+		}
+		return "", unrecognizedImage(data, srcPath)
+	}
+	if ext == "" {
+		ext = detected
+	} else if validImageExts[ext] != detected {
+		return "", fmt.Errorf("image extension %s does not match its content (%s)", ext, strings.TrimPrefix(detected, "."))
+	}
 
-	// Copy file
-	src, err := os.Open(srcPath)
+	data, err = processImage(data, detected, opts)
 	if err != nil {
-		return "", fmt.Errorf("opening image: %w", err)
+		return "", err
 	}
-	defer src.Close()
 
-	dstPath := filepath.Join(destDir, newFilename)
-	dst, err := os.Create(dstPath)
+	return saveImage(data, ext, destDir, opts)
+}
+
+// SaveImage stores raw image data, such as an image read from stdin, in
+// destDir with a generated filename. The format is detected from the data
+// and determines the extension. Returns the new filename.
+func SaveImage(data []byte, destDir string, opts CopyOptions) (string, error) {
+	detected := DetectImageFormat(data)
+	if detected == "" {
+		return "", unrecognizedImage(data, "")
+	}
+	data, err := processImage(data, detected, opts)
 	if err != nil {
-		return "", fmt.Errorf("creating destination: %w", err)
+		return "", err
+	}
+	return saveImage(data, detected, destDir, opts)
+}
+
+// unrecognizedImage returns the error for data that is not a recognized
+// image, read from the file named name if not "". PDFs get their own
+// message: markdown cannot show them as images.
+func unrecognizedImage(data []byte, name string) error {
+	if bytes.HasPrefix(data, []byte("%PDF-")) {
+		return fmt.Errorf("PDF files are not supported as images: convert the page to PNG first")
+	}
+	if name == "" {
+		return fmt.Errorf("unrecognized image format")
 	}
-	defer dst.Close()
+	return fmt.Errorf("unrecognized image format: %s", name)
+}
 
-	if _, err := io.Copy(dst, src); err != nil {
+// saveImage writes image data to destDir under a generated filename with
+// the given extension and returns the filename.
+func saveImage(data []byte, ext, destDir string, opts CopyOptions) (string, error) {
+	// Generate destination filename
+	var newFilename string
+	if opts.ContentHash {
+		newFilename = HashedImageName(data, ext)
+	} else {
+		id := uuid.New().String()[:8]
+		date := time.Now().UTC().Format("2006-01-02")
+		newFilename = fmt.Sprintf("%s-%s%s", id, date, ext)
+	}
+
+	dstPath := filepath.Join(destDir, newFilename)
+	if opts.ContentHash {
+		// The name is derived from the content, so an existing file with
+		// the same name already holds this image.
+		if existing, err := os.ReadFile(dstPath); err == nil && bytes.Equal(existing, data) {
+			return newFilename, nil
+		}
+	}
+	if err := os.WriteFile(dstPath, data, 0644); err != nil {
 		return "", fmt.Errorf("copying image: %w", err)
 	}
 
 	return newFilename, nil
 }
 
+// HashedImageName returns the content-addressed filename for image data: the
+// first 16 hex digits of its SHA-256 hash followed by ext.
+func HashedImageName(data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16] + ext
+}
+
+// DetectImageFormat sniffs the magic bytes of data and returns the canonical
+// extension of its image format (for example ".png"), or "" if data is not a
+// recognized image.
+func DetectImageFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return ".png"
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8, 0xff}):
+		return ".jpg"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return ".gif"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return ".webp"
+	case isAVIF(data):
+		return ".avif"
+	case len(data) >= 14 && string(data[:2]) == "BM" && bytes.Equal(data[6:10], []byte{0, 0, 0, 0}):
+		return ".bmp"
+	case isSVG(data):
+		return ".svg"
+	}
+	return ""
+}
+
+// isAVIF reports whether data starts with an ISO BMFF "ftyp" box whose major
+// or compatible brands include AVIF.
+func isAVIF(data []byte) bool {
+	if len(data) < 16 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	size := int(binary.BigEndian.Uint32(data[:4]))
+	if size > len(data) {
+		size = len(data)
+	}
+	for i := 8; i+4 <= size; i += 4 {
+		if i == 12 {
+			continue // minor version, not a brand
+		}
+		if brand := string(data[i : i+4]); brand == "avif" || brand == "avis" {
+			return true
+		}
+	}
+	return false
+}
+
+// isSVG reports whether data looks like an SVG document: XML whose first
+// element, after any declaration, comments and doctype, is <svg>.
+func isSVG(data []byte) bool {
+	if len(data) > 4096 {
+		data = data[:4096]
+	}
+	s := strings.TrimPrefix(string(data), "\ufeff")
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		switch {
+		case strings.HasPrefix(s, "<?"):
+			end := strings.Index(s, "?>")
+			if end == -1 {
+				return false
+			}
+			s = s[end+2:]
+		case strings.HasPrefix(s, "<!--"):
+			end := strings.Index(s, "-->")
+			if end == -1 {
+				return false
+			}
+			s = s[end+3:]
+		case strings.HasPrefix(s, "<!DOCTYPE"), strings.HasPrefix(s, "<!doctype"):
+			end := strings.Index(s, ">")
+			if end == -1 {
+				return false
+			}
+			s = s[end+1:]
+		default:
+			return strings.HasPrefix(s, "<svg") && len(s) > 4 && strings.ContainsRune(" \t\r\n>/", rune(s[4]))
+		}
+	}
+}
+
 // RunImage runs a bash script that is expected to produce an image file.
 // The last line of stdout is treated as the path to the image.
 // The image is copied to destDir with a <uuid>-<date>.<ext> filename.
 // Returns the new filename (not the full path).
 func RunImage(script, destDir, workdir string) (string, error) {
+	return RunImageWithOptions(script, destDir, workdir, CopyOptions{})
+}
+
+// RunImageWithOptions is like RunImage but names and processes the copy as
+// configured by opts.
+func RunImageWithOptions(script, destDir, workdir string, opts CopyOptions) (string, error) {
 	output, _, err := Run("bash", script, workdir)
 	if err != nil {
 		return "", fmt.Errorf("running image script: %w", err)
@@ -82,6 +258,10 @@ func RunImage(script, destDir, workdir string) (string, error) {
 		return "", fmt.Errorf("image script produced no output")
 	}
 	srcPath := strings.TrimSpace(lines[len(lines)-1])
+	// Relative paths are relative to where the script ran.
+	if workdir != "" && !filepath.IsAbs(srcPath) {
+		srcPath = filepath.Join(workdir, srcPath)
+	}
 
-	return CopyImage(srcPath, destDir)
+	return CopyImageWithOptions(srcPath, destDir, opts)
 }
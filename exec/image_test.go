@@ -87,3 +87,155 @@ func TestCopyImageBadExt(t *testing.T) {
 		t.Error("expected error for unrecognized image format")
 	}
 }
+
+func TestCopyImageRejectsPDF(t *testing.T) {
+	pdfPath := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(pdfPath, []byte("%PDF-1.7\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := CopyImage(pdfPath, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "PDF files are not supported") {
+		t.Errorf("expected PDF to be rejected, got %v", err)
+	}
+	if _, err := SaveImage([]byte("%PDF-1.7\n"), t.TempDir(), CopyOptions{}); err == nil {
+		t.Error("expected PDF data to be rejected")
+	}
+}
+
+func TestRunImageScriptRelativeToWorkdir(t *testing.T) {
+	workdir := t.TempDir()
+	script := `printf '\x89PNG\r\n\x1a\n' > out.png && echo out.png`
+
+	destDir := t.TempDir()
+	filename, err := RunImage(script, destDir, workdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, filename)); err != nil {
+		t.Errorf("expected copied image: %v", err)
+	}
+}
+
+func TestDetectImageFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"png", "\x89PNG\r\n\x1a\n....", ".png"},
+		{"jpeg", "\xff\xd8\xff\xe0\x00\x10JFIF", ".jpg"},
+		{"gif", "GIF89a\x01\x00", ".gif"},
+		{"webp", "RIFF\x24\x00\x00\x00WEBPVP8 ", ".webp"},
+		{"avif", "\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1", ".avif"},
+		{"avif compatible brand", "\x00\x00\x00\x1cftypmif1\x00\x00\x00\x00mif1avif", ".avif"},
+		{"mp4 is not avif", "\x00\x00\x00\x18ftypisom\x00\x00\x00\x00isom", ""},
+		{"bmp", "BM\x3a\x00\x00\x00\x00\x00\x00\x00\x36\x00\x00\x00", ".bmp"},
+		{"pdf is not an image", "%PDF-1.7\n", ""},
+		{"svg", "<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>", ".svg"},
+		{"svg with prolog", "<?xml version=\"1.0\"?>\n<!-- made by hand -->\n<!DOCTYPE svg>\n<svg>", ".svg"},
+		{"html", "<html><svg></svg></html>", ""},
+		{"text", "hello", ""},
+	}
+	for _, tt := range tests {
+		if got := DetectImageFormat([]byte(tt.data)); got != tt.want {
+			t.Errorf("%s: DetectImageFormat = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCopyImageMislabeled(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "photo.png")
+	// JPEG content with a .png extension
+	if err := os.WriteFile(path, []byte("\xff\xd8\xff\xe0\x00\x10JFIF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := CopyImage(path, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("expected mismatch error, got %v", err)
+	}
+}
+
+func TestCopyImageExtensionless(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "screenshot")
+	if err := os.WriteFile(path, []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	filename, err := CopyImage(path, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(filename, ".webp") {
+		t.Errorf("expected .webp suffix, got %q", filename)
+	}
+}
+
+func TestCopyImageKeepsJPEGExtension(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "photo.JPEG")
+	if err := os.WriteFile(path, []byte("\xff\xd8\xff\xe0\x00\x10JFIF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	filename, err := CopyImage(path, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(filename, ".jpeg") {
+		t.Errorf("expected .jpeg suffix, got %q", filename)
+	}
+}
+
+func TestCopyImageContentHash(t *testing.T) {
+	tmpDir := t.TempDir()
+	first := filepath.Join(tmpDir, "first.png")
+	second := filepath.Join(tmpDir, "second.png")
+	content := []byte("\x89PNG\r\n\x1a\nsame")
+	if err := os.WriteFile(first, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	destDir := t.TempDir()
+	opts := CopyOptions{ContentHash: true}
+	name1, err := CopyImageWithOptions(first, destDir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name2, err := CopyImageWithOptions(second, destDir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name1 != name2 {
+		t.Errorf("expected identical images to share a name, got %q and %q", name1, name2)
+	}
+	if name1 != HashedImageName(content, ".png") || len(name1) != len("0123456789abcdef.png") {
+		t.Errorf("unexpected hashed name %q", name1)
+	}
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected 1 file in destination, got %d", len(entries))
+	}
+}
+
+func TestSaveImage(t *testing.T) {
+	dir := t.TempDir()
+	name, err := SaveImage([]byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"), dir, CopyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(name) != ".gif" {
+		t.Errorf("expected .gif extension from content, got %q", name)
+	}
+	if _, err := SaveImage([]byte("not an image"), dir, CopyOptions{}); err == nil {
+		t.Error("expected error for unrecognized data")
+	}
+}
@@ -0,0 +1,320 @@
+package exec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+)
+
+// DefaultJPEGQuality is the quality JPEG images are re-encoded at when they
+// are resized without an explicit quality.
+const DefaultJPEGQuality = 90
+
+// processImage applies the resizing, re-encoding and metadata stripping
+// requested by opts to image data in the format ext. Data is returned
+// unchanged when opts requests none of them.
+func processImage(data []byte, ext string, opts CopyOptions) ([]byte, error) {
+	if opts.MaxWidth == 0 && opts.Quality == 0 && !opts.Strip {
+		return data, nil
+	}
+	if ext != ".png" && ext != ".jpg" {
+		return nil, fmt.Errorf("--max-width, --quality and --strip are only supported for PNG and JPEG images, not %s", strings.TrimPrefix(ext, "."))
+	}
+	if opts.MaxWidth < 0 {
+		return nil, fmt.Errorf("invalid maximum width: %d", opts.MaxWidth)
+	}
+	if opts.Quality < 0 || opts.Quality > 100 {
+		return nil, fmt.Errorf("invalid quality: %d (expected 1 to 100)", opts.Quality)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	// The EXIF orientation is applied to the pixels before resizing, so
+	// that the maximum width is that of the image as shown, and because
+	// re-encoding drops the EXIF segment that holds it.
+	orientation := 1
+	if ext == ".jpg" {
+		orientation = jpegOrientation(data)
+	}
+	width := img.Bounds().Dx()
+	if orientation >= 5 {
+		width = img.Bounds().Dy()
+	}
+	resize := opts.MaxWidth > 0 && width > opts.MaxWidth
+	if !resize && opts.Quality == 0 {
+		return stripMetadata(data, ext)
+	}
+	img = orientImage(img, orientation)
+	if resize {
+		img = resizeImage(img, opts.MaxWidth)
+	}
+
+	// Re-encoding writes only pixel data, so metadata is dropped as well.
+	var buf bytes.Buffer
+	if ext == ".jpg" {
+		quality := opts.Quality
+		if quality == 0 {
+			quality = DefaultJPEGQuality
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	} else {
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		err = enc.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encoding image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// resizeImage scales img down to the given width, keeping its aspect ratio.
+// Each output pixel is the average of the source pixels it covers.
+func resizeImage(img image.Image, width int) image.Image {
+	src := img.Bounds()
+	sw, sh := src.Dx(), src.Dy()
+	height := (sh*width + sw/2) / sw
+	if height < 1 {
+		height = 1
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * sh / height
+		y1 := max((y+1)*sh/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := x * sw / width
+			x1 := max((x+1)*sw/width, x0+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(src.Min.X+sx, src.Min.Y+sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			out.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n),
+			})
+		}
+	}
+	return out
+}
+
+// orientImage returns img transformed by EXIF orientation o, so that it is
+// upright without the orientation tag. Orientations 5 to 8 swap the width
+// and height.
+func orientImage(img image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return img
+	}
+	src := img.Bounds()
+	w, h := src.Dx(), src.Dy()
+	ow, oh := w, h
+	if o >= 5 {
+		ow, oh = h, w
+	}
+	out := image.NewRGBA64(image.Rect(0, 0, ow, oh))
+	for y := 0; y < oh; y++ {
+		for x := 0; x < ow; x++ {
+			// (sx, sy) is the stored pixel shown at (x, y).
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			out.Set(x, y, img.At(src.Min.X+sx, src.Min.Y+sy))
+		}
+	}
+	return out
+}
+
+// jpegOrientation returns the EXIF orientation of JPEG data, or 1 if it has
+// none.
+func jpegOrientation(data []byte) int {
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xff; {
+		marker := data[pos+1]
+		if marker == 0xff {
+			pos++
+			continue
+		}
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			break
+		}
+		if marker == 0xe1 {
+			if o := exifOrientation(data[pos+4 : end]); o > 1 {
+				return o
+			}
+		}
+		pos = end
+	}
+	return 1
+}
+
+// stripMetadata removes metadata that does not affect how an image is
+// displayed, such as EXIF, XMP and text comments, without re-encoding it.
+func stripMetadata(data []byte, ext string) ([]byte, error) {
+	if ext == ".jpg" {
+		return stripJPEG(data)
+	}
+	return stripPNG(data)
+}
+
+// strippedPNGChunks are the ancillary PNG chunks removed by stripPNG.
+var strippedPNGChunks = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+// exifOrientation returns the orientation tag (1 to 8) of an APP1 segment
+// payload holding EXIF data, or 0 if it has none.
+func exifOrientation(payload []byte) int {
+	tiff, ok := bytes.CutPrefix(payload, []byte("Exif\x00\x00"))
+	if !ok || len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// Orientation is tag 0x0112, a single SHORT.
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// orientationSegment returns an APP1 segment with EXIF data holding only
+// the orientation tag o.
+func orientationSegment(o int) []byte {
+	tiff := []byte("MM\x00*")
+	tiff = binary.BigEndian.AppendUint32(tiff, 8) // offset of the first IFD
+	tiff = binary.BigEndian.AppendUint16(tiff, 1) // one entry
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1) // one value
+	tiff = binary.BigEndian.AppendUint16(tiff, uint16(o))
+	tiff = binary.BigEndian.AppendUint16(tiff, 0) // padding
+	tiff = binary.BigEndian.AppendUint32(tiff, 0) // no next IFD
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	seg := []byte{0xff, 0xe1}
+	seg = binary.BigEndian.AppendUint16(seg, uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// stripPNG removes text, EXIF and timestamp chunks from PNG data.
+func stripPNG(data []byte) ([]byte, error) {
+	const sigLen = 8
+	out := append([]byte{}, data[:sigLen]...)
+	for pos := sigLen; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, fmt.Errorf("stripping PNG metadata: truncated chunk")
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if end > len(data) {
+			return nil, fmt.Errorf("stripping PNG metadata: truncated chunk")
+		}
+		if !strippedPNGChunks[string(data[pos+4:pos+8])] {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	return out, nil
+}
+
+// stripJPEG removes EXIF, XMP and other application segments and comments
+// from JPEG data. The APP0 (JFIF), APP2 (ICC profile) and APP14 (Adobe color
+// transform) segments are kept because they affect how the image is shown.
+// So is the EXIF orientation, which rotates photos as they were taken: an
+// EXIF segment holding only that tag replaces the original.
+func stripJPEG(data []byte) ([]byte, error) {
+	out := append([]byte{}, data[:2]...)
+	orientationKept := false
+	for pos := 2; pos < len(data); {
+		if pos+2 > len(data) || data[pos] != 0xff {
+			return nil, fmt.Errorf("stripping JPEG metadata: invalid segment")
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte before a marker.
+			pos++
+			continue
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd9):
+			// Markers without a length.
+			out = append(out, data[pos:pos+2]...)
+			pos += 2
+			continue
+		}
+		if pos+4 > len(data) {
+			return nil, fmt.Errorf("stripping JPEG metadata: truncated segment")
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			return nil, fmt.Errorf("stripping JPEG metadata: truncated segment")
+		}
+		if marker == 0xda {
+			// Start of scan: the rest is entropy-coded image data.
+			return append(out, data[pos:]...), nil
+		}
+		isAPP := marker >= 0xe1 && marker <= 0xef
+		keep := !(isAPP && marker != 0xe2 && marker != 0xee) && marker != 0xfe
+		if keep {
+			out = append(out, data[pos:end]...)
+		}
+		if marker == 0xe1 && !orientationKept {
+			if o := exifOrientation(data[pos+4 : end]); o > 1 {
+				out = append(out, orientationSegment(o)...)
+				orientationKept = true
+			}
+		}
+		pos = end
+	}
+	return out, nil
+}
@@ -0,0 +1,271 @@
+package exec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// encodeTestImage returns a w x h image with a dark top-left quarter, encoded
+// in the format ext.
+func encodeTestImage(t *testing.T, w, h int, ext string) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			if x < w/2 && y < h/2 {
+				c = color.RGBA{R: 20, G: 40, B: 60, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if ext == ".jpg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngChunk builds a PNG chunk with a valid CRC.
+func pngChunk(typ string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, typ...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(append([]byte(typ), data...)))
+}
+
+func TestCopyImageMaxWidth(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "wide.png")
+	if err := os.WriteFile(src, encodeTestImage(t, 200, 100, ".png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := CopyImageWithOptions(src, dir, CopyOptions{MaxWidth: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := decodeImage(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds(); got.Dx() != 50 || got.Dy() != 25 {
+		t.Errorf("expected 50x25, got %dx%d", got.Dx(), got.Dy())
+	}
+	// The dark quarter should survive resizing.
+	if lum := luminance(img.At(5, 5)); lum > 100 {
+		t.Errorf("expected dark top-left pixel, got luminance %.0f", lum)
+	}
+}
+
+func TestCopyImageMaxWidthKeepsSmallImages(t *testing.T) {
+	dir := t.TempDir()
+	data := encodeTestImage(t, 20, 10, ".png")
+	src := filepath.Join(dir, "small.png")
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := CopyImageWithOptions(src, dir, CopyOptions{MaxWidth: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("expected an image narrower than the maximum to be copied unchanged")
+	}
+}
+
+func TestCopyImageQualityJPEG(t *testing.T) {
+	dir := t.TempDir()
+	data := encodeTestImage(t, 64, 64, ".jpg")
+	src := filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := CopyImageWithOptions(src, dir, CopyOptions{Quality: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) >= len(data) {
+		t.Errorf("expected low quality re-encode to be smaller: %d >= %d", len(got), len(data))
+	}
+	if DetectImageFormat(got) != ".jpg" {
+		t.Error("expected a JPEG")
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	data := encodeTestImage(t, 4, 4, ".png")
+	// Insert a tEXt chunk after IHDR (8 byte signature + 25 byte chunk).
+	text := pngChunk("tEXt", []byte("Comment\x00/home/me/secret"))
+	withText := append(append(append([]byte{}, data[:33]...), text...), data[33:]...)
+
+	stripped, err := stripPNG(withText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped, []byte("secret")) {
+		t.Error("expected text chunk to be removed")
+	}
+	if !bytes.Equal(stripped, data) {
+		t.Error("expected only the text chunk to be removed")
+	}
+}
+
+func TestStripJPEG(t *testing.T) {
+	data := encodeTestImage(t, 8, 8, ".jpg")
+	payload := []byte("Exif\x00\x00GPS 51.5N")
+	app1 := []byte{0xff, 0xe1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(payload)+2))
+	app1 = append(app1, payload...)
+	withExif := append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(src, withExif, 0644); err != nil {
+		t.Fatal(err)
+	}
+	name, err := CopyImageWithOptions(src, dir, CopyOptions{Strip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(got, []byte("GPS")) {
+		t.Error("expected EXIF segment to be removed")
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("expected only the EXIF segment to be removed")
+	}
+}
+
+func TestStripJPEGKeepsOrientation(t *testing.T) {
+	data := encodeTestImage(t, 8, 8, ".jpg")
+	// A little-endian EXIF block with a GPS tag and orientation 6.
+	tiff := []byte("II*\x00")
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 2)
+	tiff = append(tiff, 0x12, 0x01, 3, 0, 1, 0, 0, 0, 6, 0, 0, 0)
+	tiff = append(tiff, 0x25, 0x88, 4, 0, 1, 0, 0, 0, 0, 0, 0, 0)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 0)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	payload = append(payload, "GPS 51.5N"...)
+	app1 := []byte{0xff, 0xe1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(payload)+2))
+	app1 = append(app1, payload...)
+	withExif := append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+
+	got, err := stripJPEG(withExif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(got, []byte("GPS")) {
+		t.Error("expected the rest of the EXIF data to be removed")
+	}
+	want := append(append(append([]byte{}, data[:2]...), orientationSegment(6)...), data[2:]...)
+	if !bytes.Equal(got, want) {
+		t.Error("expected an EXIF segment holding only the orientation")
+	}
+	if o := exifOrientation(orientationSegment(6)[4:]); o != 6 {
+		t.Errorf("expected orientation 6, got %d", o)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(got)); err != nil {
+		t.Errorf("stripped JPEG does not decode: %v", err)
+	}
+}
+
+func TestCopyImageMaxWidthAppliesOrientation(t *testing.T) {
+	// A 40x20 JPEG tagged to be rotated 90° clockwise is shown 20x40, with
+	// its dark quarter at the top right.
+	data := encodeTestImage(t, 40, 20, ".jpg")
+	rotated := append(append(append([]byte{}, data[:2]...), orientationSegment(6)...), data[2:]...)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(src, rotated, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resizing applies the orientation to the pixels and to the width.
+	name, err := CopyImageWithOptions(src, dir, CopyOptions{MaxWidth: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := decodeImage(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds(); got.Dx() != 10 || got.Dy() != 20 {
+		t.Fatalf("expected 10x20, got %dx%d", got.Dx(), got.Dy())
+	}
+	if lum := luminance(img.At(8, 2)); lum > 100 {
+		t.Errorf("expected dark top-right pixel, got luminance %.0f", lum)
+	}
+	if lum := luminance(img.At(1, 2)); lum < 150 {
+		t.Errorf("expected light top-left pixel, got luminance %.0f", lum)
+	}
+
+	// An image no wider than the maximum once rotated is left alone.
+	name, err = CopyImageWithOptions(src, dir, CopyOptions{MaxWidth: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, rotated) {
+		t.Error("expected an image narrower than the maximum as shown to be copied unchanged")
+	}
+}
+
+func TestProcessImageRejectsOtherFormats(t *testing.T) {
+	dir := t.TempDir()
+	images := map[string][]byte{
+		"drawing.svg": []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`),
+		"photo.webp":  []byte("RIFF\x00\x00\x00\x00WEBPVP8 "),
+	}
+	for name, data := range images {
+		src := filepath.Join(dir, name)
+		if err := os.WriteFile(src, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, opts := range []CopyOptions{{Strip: true}, {MaxWidth: 100}, {Quality: 80}} {
+			if _, err := CopyImageWithOptions(src, dir, opts); err == nil || !strings.Contains(err.Error(), "only supported for PNG and JPEG") {
+				t.Errorf("expected %s to be rejected with %+v, got %v", name, opts, err)
+			}
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(images) {
+		t.Errorf("expected nothing to be copied, got %d entries", len(entries))
+	}
+}
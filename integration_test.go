@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bytes"
+	"image"
+	"image/png"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -165,6 +168,47 @@ func TestBuildRunOutputAndExitCode(t *testing.T) {
 	}
 }
 
+func TestExecExpectExit(t *testing.T) {
+	tmpBin := filepath.Join(t.TempDir(), "showboat")
+	build := exec.Command("go", "build", "-o", tmpBin, ".")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build failed: %s\n%s", err, out)
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	run(t, tmpBin, "init", file, "Expect Exit Test")
+
+	// A met expectation exits 0 even though the command failed
+	out := runOutput(t, tmpBin, "exec", file, "bash", "echo bad config && exit 3", "--expect-exit", "3")
+	if !strings.Contains(out, "bad config") {
+		t.Errorf("expected output to be printed, got: %q", out)
+	}
+
+	// An unmet expectation exits non-zero
+	cmd := exec.Command(tmpBin, "exec", file, "bash", "echo fine", "--expect-failure")
+	if err := cmd.Run(); err == nil {
+		t.Error("expected exec to fail when an expected failure succeeds")
+	}
+
+	// Exit codes a process cannot return are rejected
+	for _, code := range []string{"0", "256", "-1"} {
+		cmd := exec.Command(tmpBin, "exec", file, "bash", "exit 1", "--expect-exit", code)
+		if out, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(out), "must be 1 to 255") {
+			t.Errorf("expected --expect-exit %s to be rejected, got %v: %s", code, err, out)
+		}
+	}
+
+	content, _ := os.ReadFile(file)
+	if !strings.Contains(string(content), "```bash {expect-exit=3}") {
+		t.Errorf("expected exit attribute in document, got: %s", content)
+	}
+	if strings.Contains(string(content), "exit 1") {
+		t.Errorf("expected rejected blocks not to be recorded, got: %s", content)
+	}
+}
+
 func TestPop(t *testing.T) {
 	tmpBin := filepath.Join(t.TempDir(), "showboat")
 	build := exec.Command("go", "build", "-o", tmpBin, ".")
@@ -250,3 +294,131 @@ func TestVersionFlagInjectedByLdflags(t *testing.T) {
 		t.Fatalf("expected version 1.2.3, got %q", got)
 	}
 }
+
+func TestImageFromStdin(t *testing.T) {
+	tmpBin := filepath.Join(t.TempDir(), "showboat")
+	build := exec.Command("go", "build", "-o", tmpBin, ".")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build failed: %s\n%s", err, out)
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	run(t, tmpBin, "init", file, "Stdin Image Test")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(tmpBin, "image", file, "-", "--alt", "Piped chart")
+	cmd.Stdin = &buf
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("image from stdin failed: %s\n%s", err, out)
+	}
+
+	content, _ := os.ReadFile(file)
+	if !strings.Contains(string(content), "```bash {image}\n-\n```") {
+		t.Errorf("expected stdin image block, got: %s", content)
+	}
+	if !strings.Contains(string(content), "![Piped chart](") {
+		t.Errorf("expected alt text in document, got: %s", content)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.png"))
+	if len(matches) != 1 {
+		t.Errorf("expected one stored PNG, got %v", matches)
+	}
+}
+
+func TestExtractScriptRebuildsDocument(t *testing.T) {
+	binDir := t.TempDir()
+	tmpBin := filepath.Join(binDir, "showboat")
+	build := exec.Command("go", "build", "-o", tmpBin, ".")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build failed: %s\n%s", err, out)
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	run(t, tmpBin, "init", file, "Script Test", "--tag", "demo")
+	run(t, tmpBin, "note", file, "Multi-line\ncommentary with 'quotes'.")
+	run(t, tmpBin, "section", file, "Steps")
+	run(t, tmpBin, "exec", file, "bash", "echo one\necho \"$((1+1))\"")
+	stdinExec := exec.Command(tmpBin, "exec", file, "bash")
+	stdinExec.Stdin = strings.NewReader("printf 'from stdin\\n'\n")
+	if out, err := stdinExec.CombinedOutput(); err != nil {
+		t.Fatalf("exec from stdin failed: %s\n%s", err, out)
+	}
+	run(t, tmpBin, "exec", file, "bash", "echo oops; exit 4", "--expect-exit", "4")
+	// A failure recorded without an expectation does not stop the rebuild.
+	exec.Command(tmpBin, "exec", file, "bash", "echo failed; exit 1").Run()
+	original, _ := os.ReadFile(file)
+
+	script := runOutput(t, tmpBin, "extract", file, "--format", "script")
+	scriptPath := filepath.Join(t.TempDir(), "rebuild.sh")
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	rebuild := exec.Command("bash", scriptPath)
+	rebuild.Env = append(os.Environ(), "PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if out, err := rebuild.CombinedOutput(); err != nil {
+		t.Fatalf("rebuild failed: %s\n%s\nscript:\n%s", err, out, script)
+	}
+	rebuilt, _ := os.ReadFile(file)
+
+	// Everything after the title (which has a new timestamp and ID) matches.
+	body := func(doc []byte) string {
+		s := string(doc)
+		return s[strings.Index(s, "-->"):]
+	}
+	if body(rebuilt) != body(original) {
+		t.Errorf("rebuilt document differs.\noriginal:\n%s\nrebuilt:\n%s", original, rebuilt)
+	}
+
+	// A step that no longer meets its expectation stops the script and
+	// leaves the existing document alone.
+	broken := strings.Replace(script, "--expect-exit 4", "--expect-exit 5", 1)
+	if err := os.WriteFile(scriptPath, []byte(broken), 0755); err != nil {
+		t.Fatal(err)
+	}
+	rebuild = exec.Command("bash", scriptPath)
+	rebuild.Env = append(os.Environ(), "PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if out, err := rebuild.CombinedOutput(); err == nil {
+		t.Fatalf("expected the broken rebuild to fail:\n%s", out)
+	}
+	after, _ := os.ReadFile(file)
+	if string(after) != string(rebuilt) {
+		t.Errorf("failed rebuild changed the document:\n%s", after)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*rebuild*"))
+	if len(leftovers) != 0 {
+		t.Errorf("expected no temporary files, got %v", leftovers)
+	}
+}
+
+func TestExtractWarnsAboutUnknownFrontMatter(t *testing.T) {
+	binDir := t.TempDir()
+	tmpBin := filepath.Join(binDir, "showboat")
+	build := exec.Command("go", "build", "-o", tmpBin, ".")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build failed: %s\n%s", err, out)
+	}
+
+	file := filepath.Join(t.TempDir(), "demo.md")
+	doc := "---\nauthor: Jane\nlicense: MIT\nreviewers:\n  - ann\n---\n\n# Test\n\n*2026-02-06T00:00:00Z*\n"
+	if err := os.WriteFile(file, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stderr strings.Builder
+	extract := exec.Command(tmpBin, "extract", file)
+	extract.Stderr = &stderr
+	out, err := extract.Output()
+	if err != nil {
+		t.Fatalf("extract failed: %s\n%s", err, stderr.String())
+	}
+	if !strings.Contains(string(out), "--author Jane") {
+		t.Errorf("expected known front matter as flags, got: %s", out)
+	}
+	if !strings.Contains(stderr.String(), "front matter not recreated by init: license, reviewers") {
+		t.Errorf("expected a warning naming the skipped entries, got: %q", stderr.String())
+	}
+}
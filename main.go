@@ -2,11 +2,16 @@ package main
 
 import (
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/simonw/showboat/cmd"
+	"github.com/simonw/showboat/markdown"
 )
 
 //go:embed help.txt
@@ -29,80 +34,324 @@ func main() {
 
 	switch args[0] {
 	case "init":
-		if len(args) < 3 {
-			fmt.Fprintln(os.Stderr, "usage: showboat init <file> <title>")
+		var initArgs []string
+		var meta markdown.Metadata
+		initRemaining := args[1:]
+		for i := 0; i < len(initRemaining); i++ {
+			hasValue := i+1 < len(initRemaining)
+			switch {
+			case initRemaining[i] == "--author" && hasValue:
+				meta.Author = initRemaining[i+1]
+				i++
+			case initRemaining[i] == "--agent" && hasValue:
+				meta.Agent = initRemaining[i+1]
+				i++
+			case initRemaining[i] == "--tag" && hasValue:
+				meta.Tags = append(meta.Tags, initRemaining[i+1])
+				i++
+			case initRemaining[i] == "--commit" && hasValue:
+				meta.Commit = initRemaining[i+1]
+				i++
+			case initRemaining[i] == "--description" && hasValue:
+				meta.Description = initRemaining[i+1]
+				i++
+			case initRemaining[i] == "--image-names" && hasValue:
+				if initRemaining[i+1] != markdown.ImageNamesHash {
+					fmt.Fprintf(os.Stderr, "error: invalid --image-names: %s (expected %s)\n", initRemaining[i+1], markdown.ImageNamesHash)
+					os.Exit(1)
+				}
+				meta.ImageNames = initRemaining[i+1]
+				i++
+			case initRemaining[i] == "--assets" && hasValue:
+				meta.Assets = initRemaining[i+1]
+				i++
+			case initRemaining[i] == "--image-budget" && hasValue:
+				meta.ImageBudget = initRemaining[i+1]
+				i++
+			case initRemaining[i] == "--source" && hasValue:
+				meta.Sources = append(meta.Sources, initRemaining[i+1])
+				i++
+			default:
+				initArgs = append(initArgs, initRemaining[i])
+			}
+		}
+		if len(initArgs) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat init <file> <title> [--author <name>] [--agent <name>] [--tag <tag>]... [--commit <sha>] [--description <text>] [--image-names hash] [--assets <dir>] [--image-budget <size>] [--source <id>]...")
 			os.Exit(1)
 		}
-		if err := cmd.Init(args[1], args[2], version); err != nil {
+		if err := cmd.InitWithMetadata(initArgs[0], initArgs[1], version, meta); err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
 
 	case "note":
-		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: showboat note <file> [text]")
+		var noteArgs []string
+		after := -1
+		noteRemaining := args[1:]
+		for i := 0; i < len(noteRemaining); i++ {
+			if noteRemaining[i] == "--after" && i+1 < len(noteRemaining) {
+				n, err := strconv.Atoi(noteRemaining[i+1])
+				if err != nil || n < 0 {
+					fmt.Fprintf(os.Stderr, "error: invalid --after: %s\n", noteRemaining[i+1])
+					os.Exit(1)
+				}
+				after = n
+				i++
+			} else {
+				noteArgs = append(noteArgs, noteRemaining[i])
+			}
+		}
+		if len(noteArgs) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: showboat note <file> [text] [--after <n>]")
+			os.Exit(1)
+		}
+		text, err := getTextArg(noteArgs[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		if after >= 0 {
+			err = cmd.NoteAfter(noteArgs[0], text, after)
+		} else {
+			err = cmd.Note(noteArgs[0], text)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "section":
+		var sectionArgs []string
+		level := 2
+		sectionRemaining := args[1:]
+		for i := 0; i < len(sectionRemaining); i++ {
+			if sectionRemaining[i] == "--level" && i+1 < len(sectionRemaining) {
+				n, err := strconv.Atoi(sectionRemaining[i+1])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: invalid --level: %s\n", sectionRemaining[i+1])
+					os.Exit(1)
+				}
+				level = n
+				i++
+			} else {
+				sectionArgs = append(sectionArgs, sectionRemaining[i])
+			}
+		}
+		if len(sectionArgs) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: showboat section <file> [title] [--level <n>]")
 			os.Exit(1)
 		}
-		text, err := getTextArg(args[2:])
+		title, err := getTextArg(sectionArgs[1:])
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
-		if err := cmd.Note(args[1], text); err != nil {
+		if err := cmd.Section(sectionArgs[0], title, level); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "toc":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat toc <file>")
+			os.Exit(1)
+		}
+		lines, err := cmd.TableOfContents(args[1])
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
+		for _, l := range lines {
+			fmt.Println(l)
+		}
 
 	case "exec":
-		if len(args) < 3 {
-			fmt.Fprintln(os.Stderr, "usage: showboat exec <file> <lang> [code]")
+		var execArgs []string
+		var block markdown.CodeBlock
+		replace := -1
+		execRemaining := args[1:]
+		for i := 0; i < len(execRemaining); i++ {
+			switch {
+			case execRemaining[i] == "--setup":
+				block.Setup = true
+			case execRemaining[i] == "--expect-failure":
+				block.ExpectFailure = true
+			case execRemaining[i] == "--expect-exit" && i+1 < len(execRemaining):
+				n, err := strconv.Atoi(execRemaining[i+1])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: invalid --expect-exit: %s\n", execRemaining[i+1])
+					os.Exit(1)
+				}
+				if n < 1 || n > markdown.MaxExitCode {
+					fmt.Fprintf(os.Stderr, "error: --expect-exit must be 1 to %d\n", markdown.MaxExitCode)
+					os.Exit(1)
+				}
+				block.ExpectExit = n
+				i++
+			case execRemaining[i] == "--match" && i+1 < len(execRemaining):
+				if !markdown.IsMatchMode(execRemaining[i+1]) {
+					fmt.Fprintf(os.Stderr, "error: invalid --match: %s (expected one of %s)\n",
+						execRemaining[i+1], strings.Join(markdown.MatchModes, ", "))
+					os.Exit(1)
+				}
+				block.Match = execRemaining[i+1]
+				i++
+			case execRemaining[i] == "--replace" && i+1 < len(execRemaining):
+				n, err := strconv.Atoi(execRemaining[i+1])
+				if err != nil || n < 0 {
+					fmt.Fprintf(os.Stderr, "error: invalid --replace: %s\n", execRemaining[i+1])
+					os.Exit(1)
+				}
+				replace = n
+				i++
+			default:
+				execArgs = append(execArgs, execRemaining[i])
+			}
+		}
+		if len(execArgs) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat exec <file> <lang> [code] [--setup] [--expect-exit <n> | --expect-failure] [--match <mode>] [--replace <n>]")
 			os.Exit(1)
 		}
-		code, err := getTextArg(args[3:])
+		code, err := getTextArg(execArgs[2:])
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
-		output, exitCode, err := cmd.Exec(args[1], args[2], code, workdir)
+		block.Lang = execArgs[1]
+		block.Code = code
+		var output string
+		var exitCode int
+		if replace >= 0 {
+			output, exitCode, err = cmd.ExecReplace(execArgs[0], block, workdir, replace)
+		} else {
+			output, exitCode, err = cmd.ExecBlock(execArgs[0], block, workdir)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
 		fmt.Print(output)
-		if exitCode != 0 {
-			os.Exit(exitCode)
-		}
+		exitForBlock(block, exitCode)
 
-	case "image":
-		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: showboat image <file> <image|![alt](image)>")
+	case "rerun":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: showboat rerun <file> <n>")
 			os.Exit(1)
 		}
-		input, err := getTextArg(args[2:])
+		index, err := strconv.Atoi(args[2])
+		if err != nil || index < 0 {
+			fmt.Fprintf(os.Stderr, "error: invalid block: %s\n", args[2])
+			os.Exit(1)
+		}
+		output, exitCode, err := cmd.Rerun(args[1], index, workdir)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
-		if err := cmd.Image(args[1], input, workdir); err != nil {
+		fmt.Print(output)
+		block, err := cmd.CodeBlockAt(args[1], index)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
+		exitForBlock(block, exitCode)
+
+	case "image":
+		var imageArgs []string
+		var imageOpts cmd.ImageOptions
+		imageRemaining := args[1:]
+		for i := 0; i < len(imageRemaining); i++ {
+			hasValue := i+1 < len(imageRemaining)
+			switch {
+			case imageRemaining[i] == "--run":
+				imageOpts.Run = true
+			case imageRemaining[i] == "--hash":
+				imageOpts.ContentHash = true
+			case imageRemaining[i] == "--strip":
+				imageOpts.Strip = true
+			case imageRemaining[i] == "--alt" && hasValue:
+				imageOpts.Alt = imageRemaining[i+1]
+				i++
+			case imageRemaining[i] == "--max-width" && hasValue:
+				n, err := strconv.Atoi(imageRemaining[i+1])
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "error: invalid --max-width: %s\n", imageRemaining[i+1])
+					os.Exit(1)
+				}
+				imageOpts.MaxWidth = n
+				i++
+			case imageRemaining[i] == "--quality" && hasValue:
+				n, err := strconv.Atoi(imageRemaining[i+1])
+				if err != nil || n < 1 || n > 100 {
+					fmt.Fprintf(os.Stderr, "error: invalid --quality: %s (expected 1 to 100)\n", imageRemaining[i+1])
+					os.Exit(1)
+				}
+				imageOpts.Quality = n
+				i++
+			default:
+				imageArgs = append(imageArgs, imageRemaining[i])
+			}
+		}
+		if len(imageArgs) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: showboat image [--run] [--hash] [--max-width <px>] [--quality <1-100>] [--strip] [--alt <text>] <file> <image|![alt](image)|script|->")
+			os.Exit(1)
+		}
+		if len(imageArgs) > 1 && imageArgs[1] == cmd.StdinImage && !imageOpts.Run {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: reading stdin: %v\n", err)
+				os.Exit(1)
+			}
+			if err := cmd.ImageData(imageArgs[0], data, imageOpts); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			input, err := getTextArg(imageArgs[1:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			if err := cmd.ImageWithOptions(imageArgs[0], input, workdir, imageOpts); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		total, budget, err := cmd.ImageBudget(imageArgs[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		if budget > 0 && total > budget {
+			fmt.Fprintf(os.Stderr, "warning: images total %s, over the image budget of %s\n", cmd.FormatSize(total), cmd.FormatSize(budget))
+		}
 
 	case "verify":
 		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: showboat verify <file> [--output <new>]")
+			fmt.Fprintln(os.Stderr, "usage: showboat verify <file> [--output <new>] [--section <title>] [--image-threshold <0-1>]")
 			os.Exit(1)
 		}
 		file := args[1]
-		outputFile := ""
+		opts := cmd.VerifyOptions{Workdir: workdir}
 		remaining := args[2:]
 		for i := 0; i < len(remaining); i++ {
 			if remaining[i] == "--output" && i+1 < len(remaining) {
-				outputFile = remaining[i+1]
+				opts.OutputFile = remaining[i+1]
+				i++
+			} else if remaining[i] == "--section" && i+1 < len(remaining) {
+				opts.Section = remaining[i+1]
+				i++
+			} else if remaining[i] == "--image-threshold" && i+1 < len(remaining) {
+				threshold, err := strconv.ParseFloat(remaining[i+1], 64)
+				if err != nil || threshold < 0 || threshold > 1 {
+					fmt.Fprintf(os.Stderr, "error: invalid --image-threshold: %s (expected 0 to 1)\n", remaining[i+1])
+					os.Exit(1)
+				}
+				opts.ImageThreshold = &threshold
 				i++
 			}
 		}
-		diffs, err := cmd.Verify(file, outputFile, workdir)
+		diffs, err := cmd.VerifyWithOptions(file, opts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
@@ -115,30 +364,167 @@ func main() {
 		}
 
 	case "pop":
+		var popArgs []string
+		count := 1
+		popRemaining := args[1:]
+		for i := 0; i < len(popRemaining); i++ {
+			if popRemaining[i] == "-n" && i+1 < len(popRemaining) {
+				n, err := strconv.Atoi(popRemaining[i+1])
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "error: invalid -n: %s\n", popRemaining[i+1])
+					os.Exit(1)
+				}
+				count = n
+				i++
+			} else {
+				popArgs = append(popArgs, popRemaining[i])
+			}
+		}
+		if len(popArgs) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: showboat pop <file> [-n <count>]")
+			os.Exit(1)
+		}
+		if err := cmd.PopN(popArgs[0], count); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "remove":
+		var removeArgs []string
+		block := -1
+		removeRemaining := args[1:]
+		for i := 0; i < len(removeRemaining); i++ {
+			if removeRemaining[i] == "--block" && i+1 < len(removeRemaining) {
+				n, err := strconv.Atoi(removeRemaining[i+1])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: invalid --block: %s\n", removeRemaining[i+1])
+					os.Exit(1)
+				}
+				block = n
+				i++
+			} else {
+				removeArgs = append(removeArgs, removeRemaining[i])
+			}
+		}
+		if len(removeArgs) < 1 || block < 0 {
+			fmt.Fprintln(os.Stderr, "usage: showboat remove <file> --block <n>")
+			os.Exit(1)
+		}
+		if err := cmd.Remove(removeArgs[0], block); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "undo":
 		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: showboat pop <file>")
+			fmt.Fprintln(os.Stderr, "usage: showboat undo <file>")
 			os.Exit(1)
 		}
-		if err := cmd.Pop(args[1]); err != nil {
+		if err := cmd.Undo(args[1]); err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
 
+	case "gc":
+		var gcArgs []string
+		var opts cmd.GCOptions
+		for _, a := range args[1:] {
+			if a == "--dry-run" {
+				opts.DryRun = true
+			} else if a == "--keep-undo" {
+				opts.KeepUndo = true
+			} else {
+				gcArgs = append(gcArgs, a)
+			}
+		}
+		if len(gcArgs) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: showboat gc <file> [--dry-run] [--keep-undo]")
+			os.Exit(1)
+		}
+		result, err := cmd.GC(gcArgs[0], opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		verb := "removed"
+		if opts.DryRun {
+			verb = "would remove"
+		}
+		for _, f := range result.Removed {
+			fmt.Printf("%s %s\n", verb, f)
+		}
+		for _, f := range result.Missing {
+			fmt.Fprintf(os.Stderr, "missing image: %s\n", f)
+		}
+		if len(result.Missing) > 0 {
+			os.Exit(1)
+		}
+
 	case "extract":
 		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: showboat extract <file> [--filename <name>]")
+			fmt.Fprintln(os.Stderr, "usage: showboat extract <file> [--filename <name>] [--section <title>] [--format commands|script|json] [--tangle <dir>]")
 			os.Exit(1)
 		}
 		extractFile := args[1]
 		extractOutput := ""
+		extractSection := ""
+		extractFormat := "commands"
+		extractTangle := ""
 		extractRemaining := args[2:]
 		for i := 0; i < len(extractRemaining); i++ {
 			if extractRemaining[i] == "--filename" && i+1 < len(extractRemaining) {
 				extractOutput = extractRemaining[i+1]
 				i++
+			} else if extractRemaining[i] == "--section" && i+1 < len(extractRemaining) {
+				extractSection = extractRemaining[i+1]
+				i++
+			} else if extractRemaining[i] == "--format" && i+1 < len(extractRemaining) {
+				extractFormat = extractRemaining[i+1]
+				i++
+			} else if extractRemaining[i] == "--tangle" && i+1 < len(extractRemaining) {
+				extractTangle = extractRemaining[i+1]
+				i++
 			}
 		}
-		commands, err := cmd.Extract(extractFile, extractOutput)
+		if extractTangle != "" {
+			written, err := cmd.Tangle(extractFile, extractTangle, extractSection)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			for _, w := range written {
+				fmt.Println(w)
+			}
+			break
+		}
+		if extractFormat == "script" {
+			script, err := cmd.ExtractScript(extractFile, extractOutput, extractSection)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(script)
+			break
+		}
+		if extractFormat == "json" {
+			steps, err := cmd.ExtractSteps(extractFile, extractOutput, extractSection)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			data, err := json.MarshalIndent(steps, "", "  ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(data))
+			break
+		}
+		if extractFormat != "commands" {
+			fmt.Fprintf(os.Stderr, "error: invalid --format: %s (expected commands, script or json)\n", extractFormat)
+			os.Exit(1)
+		}
+		commands, err := cmd.ExtractSection(extractFile, extractOutput, extractSection)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
@@ -147,6 +533,225 @@ func main() {
 			fmt.Println(c)
 		}
 
+	case "replay":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat replay <commands-file|->")
+			os.Exit(1)
+		}
+		in := os.Stdin
+		if args[1] != "-" {
+			f, err := os.Open(args[1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			in = f
+		}
+		steps, err := cmd.ParseSteps(in)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := cmd.Replay(steps, workdir, version, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "export":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat export <file> --format ipynb|html|asciicast|json [--output <path>] [--section <title>] [--typing-delay <d>] [--output-delay <d>] [--entry-delay <d>]")
+			os.Exit(1)
+		}
+		exportFile := args[1]
+		exportFormat := ""
+		exportOutput := ""
+		exportSection := ""
+		var castOpts cmd.AsciicastOptions
+		exportRemaining := args[2:]
+		for i := 0; i < len(exportRemaining); i++ {
+			if exportRemaining[i] == "--format" && i+1 < len(exportRemaining) {
+				exportFormat = exportRemaining[i+1]
+				i++
+			} else if exportRemaining[i] == "--output" && i+1 < len(exportRemaining) {
+				exportOutput = exportRemaining[i+1]
+				i++
+			} else if exportRemaining[i] == "--section" && i+1 < len(exportRemaining) {
+				exportSection = exportRemaining[i+1]
+				castOpts.Section = exportSection
+				i++
+			} else if exportRemaining[i] == "--typing-delay" && i+1 < len(exportRemaining) {
+				castOpts.TypingDelay = parseDelayFlag(exportRemaining[i], exportRemaining[i+1])
+				i++
+			} else if exportRemaining[i] == "--output-delay" && i+1 < len(exportRemaining) {
+				castOpts.OutputDelay = parseDelayFlag(exportRemaining[i], exportRemaining[i+1])
+				i++
+			} else if exportRemaining[i] == "--entry-delay" && i+1 < len(exportRemaining) {
+				castOpts.EntryDelay = parseDelayFlag(exportRemaining[i], exportRemaining[i+1])
+				i++
+			}
+		}
+		exporters := map[string]func(string, io.Writer) error{
+			"ipynb": func(file string, w io.Writer) error {
+				return cmd.ExportNotebookSection(file, exportSection, w)
+			},
+			"html": func(file string, w io.Writer) error {
+				return cmd.ExportHTMLSection(file, exportSection, w)
+			},
+			"json": func(file string, w io.Writer) error {
+				return cmd.ExportJSONSection(file, exportSection, w)
+			},
+			"asciicast": func(file string, w io.Writer) error {
+				return cmd.ExportAsciicastWithOptions(file, w, castOpts)
+			},
+		}
+		export, ok := exporters[exportFormat]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "error: invalid --format: %q (expected ipynb, html, asciicast or json)\n", exportFormat)
+			os.Exit(1)
+		}
+		var err error
+		if exportOutput != "" {
+			err = cmd.ExportFile(exportFile, exportOutput, export)
+		} else {
+			err = export(exportFile, os.Stdout)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "import":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: showboat import <source> <file> [--format ipynb|json]")
+			os.Exit(1)
+		}
+		importFormat := "ipynb"
+		importRemaining := args[3:]
+		for i := 0; i < len(importRemaining); i++ {
+			if importRemaining[i] == "--format" && i+1 < len(importRemaining) {
+				importFormat = importRemaining[i+1]
+				i++
+			}
+		}
+		var err error
+		switch importFormat {
+		case "ipynb":
+			err = cmd.ImportNotebook(args[1], args[2], version)
+		case "json":
+			err = cmd.ImportJSON(args[1], args[2])
+		default:
+			err = fmt.Errorf("invalid --format: %q (expected ipynb or json)", importFormat)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "merge":
+		var mergeFiles []string
+		mergeOutput := ""
+		var mergeOpts cmd.MergeOptions
+		mergeRemaining := args[1:]
+		for i := 0; i < len(mergeRemaining); i++ {
+			if (mergeRemaining[i] == "-o" || mergeRemaining[i] == "--output") && i+1 < len(mergeRemaining) {
+				mergeOutput = mergeRemaining[i+1]
+				i++
+			} else if mergeRemaining[i] == "--title" && i+1 < len(mergeRemaining) {
+				mergeOpts.Title = mergeRemaining[i+1]
+				i++
+			} else if mergeRemaining[i] == "--sections" {
+				mergeOpts.Sections = true
+			} else {
+				mergeFiles = append(mergeFiles, mergeRemaining[i])
+			}
+		}
+		if len(mergeFiles) == 0 || mergeOutput == "" {
+			fmt.Fprintln(os.Stderr, "usage: showboat merge <file>... -o <combined> [--title <title>] [--sections]")
+			os.Exit(1)
+		}
+		if err := cmd.Merge(mergeOutput, mergeFiles, version, mergeOpts); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "split":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat split <file> --by heading | --every <n> [--dir <dir>]")
+			os.Exit(1)
+		}
+		var splitOpts cmd.SplitOptions
+		splitRemaining := args[2:]
+		for i := 0; i < len(splitRemaining); i++ {
+			if splitRemaining[i] == "--by" && i+1 < len(splitRemaining) {
+				if splitRemaining[i+1] != "heading" {
+					fmt.Fprintf(os.Stderr, "error: invalid --by: %s (expected heading)\n", splitRemaining[i+1])
+					os.Exit(1)
+				}
+				splitOpts.ByHeading = true
+				i++
+			} else if splitRemaining[i] == "--every" && i+1 < len(splitRemaining) {
+				n, err := strconv.Atoi(splitRemaining[i+1])
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "error: invalid --every: %s (expected a positive number)\n", splitRemaining[i+1])
+					os.Exit(1)
+				}
+				splitOpts.Every = n
+				i++
+			} else if splitRemaining[i] == "--dir" && i+1 < len(splitRemaining) {
+				splitOpts.Dir = splitRemaining[i+1]
+				i++
+			}
+		}
+		written, err := cmd.Split(args[1], version, splitOpts)
+		for _, w := range written {
+			fmt.Println(w)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "info":
+		var infoFiles []string
+		infoJSON := false
+		for _, arg := range args[1:] {
+			if arg == "--json" {
+				infoJSON = true
+			} else {
+				infoFiles = append(infoFiles, arg)
+			}
+		}
+		if len(infoFiles) == 0 {
+			fmt.Fprintln(os.Stderr, "usage: showboat info <file>... [--json]")
+			os.Exit(1)
+		}
+		failed := false
+		for i, file := range infoFiles {
+			info, err := cmd.Info(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %s: %v\n", file, err)
+				failed = true
+				continue
+			}
+			if infoJSON {
+				data, err := json.Marshal(info)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(data))
+				continue
+			}
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Print(info.String())
+		}
+		if failed {
+			os.Exit(1)
+		}
+
 	case "--help", "-h", "help":
 		printUsage()
 		os.Exit(0)
@@ -174,6 +779,36 @@ func parseGlobalFlags(args []string) (remaining []string, workdir string, showVe
 	return remaining, workdir, showVersion
 }
 
+// parseDelayFlag parses the duration value of a timing flag, exiting with
+// an error if it is not a positive duration.
+func parseDelayFlag(flag, value string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		fmt.Fprintf(os.Stderr, "error: invalid %s: %s (expected a duration such as 50ms or 1.5s)\n", flag, value)
+		os.Exit(1)
+	}
+	return d
+}
+
+// exitForBlock exits with the status for a code block that ran with
+// exitCode: the exit code itself, unless the block records an expected exit
+// code, in which case it exits 0 when the expectation is met and non-zero
+// otherwise.
+func exitForBlock(block markdown.CodeBlock, exitCode int) {
+	if block.ExpectExit != 0 || block.ExpectFailure {
+		// The expectation replaces the pass-through exit code.
+		if !cmd.ExitCodeMatches(block, exitCode) {
+			fmt.Fprintf(os.Stderr, "error: expected exit code %s, got %d\n", cmd.DescribeExpectedExit(block), exitCode)
+			if exitCode == 0 {
+				exitCode = 1
+			}
+			os.Exit(exitCode)
+		}
+	} else if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
+
 // getTextArg returns args[0] if present, otherwise reads all of stdin.
 func getTextArg(args []string) (string, error) {
 	if len(args) > 0 {
@@ -1,16 +1,20 @@
 package markdown
 
+import "fmt"
+
 // Block is an element in a showboat document.
 type Block interface {
 	Type() string
 }
 
-// TitleBlock is the document header: an H1 title and a timestamp.
+// TitleBlock is the document header: an H1 title and a timestamp, preceded
+// by optional YAML front matter holding the document Metadata.
 type TitleBlock struct {
 	Title      string
 	Timestamp  string
 	Version    string
 	DocumentID string
+	Metadata   Metadata
 }
 
 func (b TitleBlock) Type() string { return "title" }
@@ -22,15 +26,96 @@ type CommentaryBlock struct {
 
 func (b CommentaryBlock) Type() string { return "commentary" }
 
+// HeadingBlock is a section heading (## and deeper) that gives a document
+// structure. Level is the number of leading # characters, from 2 to 6.
+type HeadingBlock struct {
+	Level int
+	Title string
+}
+
+func (b HeadingBlock) Type() string { return "heading" }
+
 // CodeBlock is an executable fenced code block.
 type CodeBlock struct {
 	Lang    string
 	Code    string
 	IsImage bool
+	// Run marks an image block whose code is a script that creates an image
+	// and prints its path on the last line of output.
+	Run bool
+	// Setup marks preparation steps that are collapsed when rendered but
+	// still executed by verify and emitted by extract.
+	Setup bool
+	// ExpectExit, when non-zero, is the exit code the code must return:
+	// 1 to MaxExitCode.
+	ExpectExit int
+	// ExpectFailure requires the code to return any non-zero exit code.
+	ExpectFailure bool
+	// Match is how verify compares the recorded output with the actual
+	// output: one of the Match* modes. Empty means MatchExact.
+	Match string
+	// MaxWidth, Quality, Strip and Hash record how the image of an image
+	// block was stored: scaled down to at most MaxWidth pixels wide,
+	// re-encoded at JPEG Quality, with its metadata stripped, and named
+	// after a hash of its content. Zero values mean the image was stored
+	// as is.
+	MaxWidth int
+	Quality  int
+	Strip    bool
+	Hash     bool
 }
 
 func (b CodeBlock) Type() string { return "code" }
 
+// MaxExitCode is the largest exit code a process can return.
+const MaxExitCode = 255
+
+// Validate returns an error if an attribute of the block is out of range,
+// so that it could not have been recorded by showboat.
+func (b CodeBlock) Validate() error {
+	if b.ExpectExit < 0 || b.ExpectExit > MaxExitCode {
+		return fmt.Errorf("invalid expected exit code %d: must be 1 to %d", b.ExpectExit, MaxExitCode)
+	}
+	if b.Match != "" && !IsMatchMode(b.Match) {
+		return fmt.Errorf("invalid match mode: %s", b.Match)
+	}
+	if b.MaxWidth < 0 {
+		return fmt.Errorf("invalid maximum width %d: must be positive", b.MaxWidth)
+	}
+	if b.Quality < 0 || b.Quality > 100 {
+		return fmt.Errorf("invalid quality %d: must be 1 to 100", b.Quality)
+	}
+	return nil
+}
+
+// Output match modes for CodeBlock.Match.
+const (
+	// MatchExact requires the output to be identical.
+	MatchExact = "exact"
+	// MatchContains requires the recorded output to appear in the output.
+	MatchContains = "contains"
+	// MatchRegex treats the recorded output as a regular expression that
+	// must match the output.
+	MatchRegex = "regex"
+	// MatchJSON requires both outputs to be semantically equal JSON.
+	MatchJSON = "json"
+	// MatchLinesUnordered requires the same lines in any order.
+	MatchLinesUnordered = "lines-unordered"
+)
+
+// MatchModes lists the valid values of CodeBlock.Match.
+var MatchModes = []string{MatchExact, MatchContains, MatchRegex, MatchJSON, MatchLinesUnordered}
+
+// IsMatchMode reports whether mode is one of MatchModes.
+func IsMatchMode(mode string) bool {
+	for _, m := range MatchModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
 // OutputBlock is captured text output from a code block.
 type OutputBlock struct {
 	Content string
@@ -45,3 +130,38 @@ type ImageOutputBlock struct {
 }
 
 func (b ImageOutputBlock) Type() string { return "output-image" }
+
+// Metadata is optional descriptive information about a document. It is
+// serialized as YAML front matter before the title.
+type Metadata struct {
+	Author      string
+	Agent       string
+	Tags        []string
+	Commit      string
+	Description string
+	// ImageNames selects how images added to the document are named:
+	// ImageNamesHash, or empty for random <uuid>-<date> names.
+	ImageNames string
+	// Assets is the directory, relative to the document, that images are
+	// copied into. Empty means the document's own directory.
+	Assets string
+	// ImageBudget is the total size, such as "5MB", that the document's
+	// images should stay under.
+	ImageBudget string
+	// Sources lists the document IDs of the documents this one was made
+	// from by "merge" or "split".
+	Sources []string
+	// Extra holds unrecognized front matter entries verbatim so that they
+	// survive a parse/write round trip.
+	Extra string
+}
+
+// IsZero reports whether no metadata fields are set.
+func (m Metadata) IsZero() bool {
+	return m.Author == "" && m.Agent == "" && len(m.Tags) == 0 &&
+		m.Commit == "" && m.Description == "" && m.ImageNames == "" && m.Assets == "" &&
+		m.ImageBudget == "" && len(m.Sources) == 0 && m.Extra == ""
+}
+
+// ImageNamesHash names images after a hash of their content.
+const ImageNamesHash = "hash"
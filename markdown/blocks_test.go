@@ -36,3 +36,10 @@ func TestTitleBlock(t *testing.T) {
 		t.Errorf("expected type title, got %s", b.Type())
 	}
 }
+
+func TestHeadingBlock(t *testing.T) {
+	b := HeadingBlock{Level: 2, Title: "Setup"}
+	if b.Type() != "heading" {
+		t.Errorf("expected type heading, got %s", b.Type())
+	}
+}
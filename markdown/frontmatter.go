@@ -0,0 +1,291 @@
+package markdown
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// frontMatterDelim opens and closes the YAML front matter section.
+const frontMatterDelim = "---"
+
+// writeFrontMatter writes the YAML front matter for a title block. Nothing is
+// written when the metadata is empty and the title fits on a single line.
+func writeFrontMatter(w io.Writer, b TitleBlock) error {
+	m := b.Metadata
+	multiLineTitle := strings.Contains(b.Title, "\n")
+	if m.IsZero() && !multiLineTitle {
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(frontMatterDelim + "\n")
+	if multiLineTitle {
+		writeYAMLField(&sb, "title", b.Title)
+	}
+	writeYAMLField(&sb, "author", m.Author)
+	writeYAMLField(&sb, "agent", m.Agent)
+	writeYAMLList(&sb, "tags", m.Tags)
+	writeYAMLField(&sb, "commit", m.Commit)
+	writeYAMLField(&sb, "description", m.Description)
+	writeYAMLField(&sb, "image-names", m.ImageNames)
+	writeYAMLField(&sb, "assets", m.Assets)
+	writeYAMLField(&sb, "image-budget", m.ImageBudget)
+	writeYAMLList(&sb, "sources", m.Sources)
+	if m.Extra != "" {
+		sb.WriteString(strings.TrimSuffix(m.Extra, "\n") + "\n")
+	}
+	sb.WriteString(frontMatterDelim + "\n\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeYAMLField writes a "key: value" line, using a literal block scalar for
+// multi-line values. Empty values are omitted.
+func writeYAMLField(sb *strings.Builder, key, value string) {
+	if value == "" {
+		return
+	}
+	if strings.Contains(value, "\n") {
+		indicator := "|-"
+		body := value
+		if strings.HasSuffix(value, "\n") {
+			indicator = "|"
+			body = strings.TrimSuffix(value, "\n")
+		}
+		fmt.Fprintf(sb, "%s: %s\n", key, indicator)
+		for _, line := range strings.Split(body, "\n") {
+			if line == "" {
+				sb.WriteString("\n")
+			} else {
+				sb.WriteString("  " + line + "\n")
+			}
+		}
+		return
+	}
+	fmt.Fprintf(sb, "%s: %s\n", key, yamlScalar(value, ""))
+}
+
+// writeYAMLList writes a "key: [a, b]" flow sequence. Empty lists are
+// omitted.
+func writeYAMLList(sb *strings.Builder, key string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = yamlScalar(item, ",[]")
+	}
+	fmt.Fprintf(sb, "%s: [%s]\n", key, strings.Join(quoted, ", "))
+}
+
+// yamlScalar returns value as a YAML plain scalar when that is unambiguous,
+// and as a double-quoted scalar otherwise. Any character in extra also forces
+// quoting.
+func yamlScalar(value, extra string) string {
+	if value == "" {
+		return `""`
+	}
+	quote := strings.ContainsAny(value[:1], "-?:,[]{}#&*!|>'\"%@` ") ||
+		strings.HasSuffix(value, " ") ||
+		strings.Contains(value, ": ") ||
+		strings.Contains(value, " #") ||
+		strings.ContainsAny(value, extra+"\t\r")
+	switch strings.ToLower(value) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~":
+		quote = true
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		quote = true
+	}
+	if quote {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// parseFrontMatter parses YAML front matter starting at lines[0]. It returns
+// the metadata, any title override, and the number of lines consumed. ok is
+// false when lines does not start with a complete front matter section.
+func parseFrontMatter(lines []string) (m Metadata, title string, consumed int, ok bool) {
+	if len(lines) == 0 || lines[0] != frontMatterDelim {
+		return Metadata{}, "", 0, false
+	}
+	end := -1
+	for j := 1; j < len(lines); j++ {
+		if lines[j] == frontMatterDelim {
+			end = j
+			break
+		}
+	}
+	if end == -1 {
+		return Metadata{}, "", 0, false
+	}
+
+	body := lines[1:end]
+	var extra []string
+	for j := 0; j < len(body); {
+		line := body[j]
+		// Collect continuation lines: indented text, list items and blanks
+		// that belong to this entry.
+		k := j + 1
+		for k < len(body) && isYAMLContinuation(body[k]) {
+			k++
+		}
+		cont := body[j+1 : k]
+
+		key, value, found := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if !found {
+			extra = append(extra, body[j:k]...)
+			j = k
+			continue
+		}
+
+		switch key {
+		case "title":
+			title = yamlValue(value, cont)
+		case "author":
+			m.Author = yamlValue(value, cont)
+		case "agent":
+			m.Agent = yamlValue(value, cont)
+		case "commit":
+			m.Commit = yamlValue(value, cont)
+		case "description":
+			m.Description = yamlValue(value, cont)
+		case "image-names":
+			m.ImageNames = yamlValue(value, cont)
+		case "assets":
+			m.Assets = yamlValue(value, cont)
+		case "image-budget":
+			m.ImageBudget = yamlValue(value, cont)
+		case "tags":
+			m.Tags = yamlList(value, cont)
+		case "sources":
+			m.Sources = yamlList(value, cont)
+		default:
+			extra = append(extra, body[j:k]...)
+		}
+		j = k
+	}
+	if len(extra) > 0 {
+		m.Extra = strings.Join(extra, "\n")
+	}
+
+	return m, title, end + 1, true
+}
+
+// isYAMLContinuation reports whether line continues the previous entry
+// rather than starting a new top-level key.
+func isYAMLContinuation(line string) bool {
+	return line == "" || strings.HasPrefix(line, " ") ||
+		strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "- ")
+}
+
+// yamlValue decodes a scalar value, including literal and folded block
+// scalars whose content is held in cont.
+func yamlValue(value string, cont []string) string {
+	if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+		// Drop trailing blank lines; they are only kept for "|"/">".
+		for len(cont) > 0 && strings.TrimSpace(cont[len(cont)-1]) == "" {
+			cont = cont[:len(cont)-1]
+		}
+		indent := -1
+		for _, line := range cont {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			n := len(line) - len(strings.TrimLeft(line, " \t"))
+			if indent == -1 || n < indent {
+				indent = n
+			}
+		}
+		out := make([]string, len(cont))
+		for i, line := range cont {
+			if len(line) >= indent && indent > 0 {
+				out[i] = line[indent:]
+			} else {
+				out[i] = strings.TrimSpace(line)
+			}
+		}
+		sep := "\n"
+		if value[0] == '>' {
+			sep = " "
+		}
+		text := strings.Join(out, sep)
+		if !strings.HasSuffix(value, "-") {
+			text += "\n"
+		}
+		return text
+	}
+	return yamlUnquote(value)
+}
+
+// yamlList decodes a flow sequence ([a, b]) or a block sequence of "- item"
+// lines held in cont.
+func yamlList(value string, cont []string) []string {
+	var items []string
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		for _, item := range splitFlowList(value[1 : len(value)-1]) {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, yamlUnquote(item))
+			}
+		}
+		return items
+	}
+	if value != "" {
+		return []string{yamlUnquote(value)}
+	}
+	for _, line := range cont {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "- ") {
+			items = append(items, yamlUnquote(strings.TrimSpace(line[2:])))
+		}
+	}
+	return items
+}
+
+// splitFlowList splits the inside of a flow sequence on commas that are not
+// inside quotes.
+func splitFlowList(s string) []string {
+	var parts []string
+	var cur strings.Builder
+	var quote rune
+	escaped := false
+	for _, ch := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && ch == '\\':
+			escaped = true
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote == 0 && (ch == '"' || ch == '\''):
+			quote = ch
+		case quote == 0 && ch == ',':
+			parts = append(parts, cur.String())
+			cur.Reset()
+			continue
+		}
+		cur.WriteRune(ch)
+	}
+	return append(parts, cur.String())
+}
+
+// yamlUnquote decodes a single- or double-quoted scalar, returning plain
+// scalars unchanged.
+func yamlUnquote(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		if s, err := strconv.Unquote(value); err == nil {
+			return s
+		}
+		return value[1 : len(value)-1]
+	}
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+	return value
+}
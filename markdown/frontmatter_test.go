@@ -0,0 +1,118 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteTitleWithMetadata(t *testing.T) {
+	var buf strings.Builder
+	blocks := []Block{
+		TitleBlock{
+			Title:     "My Demo",
+			Timestamp: "2026-02-06T15:30:00Z",
+			Metadata: Metadata{
+				Author:      "Jane Doe",
+				Agent:       "claude",
+				Tags:        []string{"cli", "demo, extended"},
+				Commit:      "0123abc",
+				Description: "A demo: with a colon",
+			},
+		},
+	}
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	expected := "---\nauthor: Jane Doe\nagent: claude\ntags: [cli, \"demo, extended\"]\ncommit: 0123abc\ndescription: \"A demo: with a colon\"\n---\n\n# My Demo\n\n*2026-02-06T15:30:00Z*\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, buf.String())
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	input := "---\nauthor: 'Jane O''Neil'\ntags:\n  - one\n  - two\ndescription: |\n  First line.\n  Second line.\nrepo: example/demo\n---\n\n# Demo\n\n*2026-02-06T00:00:00Z*\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("expected 1 block, got %d: %+v", len(blocks), blocks)
+	}
+	tb, ok := blocks[0].(TitleBlock)
+	if !ok {
+		t.Fatalf("expected TitleBlock, got %T", blocks[0])
+	}
+	if tb.Title != "Demo" {
+		t.Errorf("expected title 'Demo', got %q", tb.Title)
+	}
+	m := tb.Metadata
+	if m.Author != "Jane O'Neil" {
+		t.Errorf("unexpected author: %q", m.Author)
+	}
+	if len(m.Tags) != 2 || m.Tags[0] != "one" || m.Tags[1] != "two" {
+		t.Errorf("unexpected tags: %q", m.Tags)
+	}
+	if m.Description != "First line.\nSecond line.\n" {
+		t.Errorf("unexpected description: %q", m.Description)
+	}
+	if m.Extra != "repo: example/demo" {
+		t.Errorf("expected unknown key preserved, got %q", m.Extra)
+	}
+}
+
+func TestRoundTripFrontMatter(t *testing.T) {
+	input := "---\ntitle: |-\n  Building a *Parser*\n  in two parts\nauthor: Jane\ntags: [a, b]\ndescription: |-\n  Line one.\n\n  Line three.\nassets: images\nsources: [abc-1, def-2]\nrepo: example/demo\n---\n\n# Building a *Parser* in two parts\n\n*2026-02-06T00:00:00Z by Showboat v0.3.0*\n<!-- showboat-id: abc-123 -->\n\nHello.\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb := blocks[0].(TitleBlock)
+	if tb.Title != "Building a *Parser*\nin two parts" {
+		t.Errorf("expected multi-line title, got %q", tb.Title)
+	}
+	if len(tb.Metadata.Sources) != 2 || tb.Metadata.Sources[1] != "def-2" {
+		t.Errorf("expected sources to be parsed, got %q", tb.Metadata.Sources)
+	}
+	var buf strings.Builder
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
+	}
+}
+
+func TestParseLeadingRuleIsNotFrontMatter(t *testing.T) {
+	input := "---\n\nJust a horizontal rule.\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("expected 1 block, got %d: %+v", len(blocks), blocks)
+	}
+	if _, ok := blocks[0].(CommentaryBlock); !ok {
+		t.Errorf("expected CommentaryBlock, got %T", blocks[0])
+	}
+}
+
+func TestYAMLScalarQuoting(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"plain", "plain"},
+		{"two words", "two words"},
+		{"", `""`},
+		{"true", `"true"`},
+		{"123", `"123"`},
+		{"- dash", `"- dash"`},
+		{"key: value", `"key: value"`},
+		{"say \"hi\"", `say "hi"`},
+	}
+	for _, tt := range tests {
+		if got := yamlScalar(tt.input, ""); got != tt.expected {
+			t.Errorf("yamlScalar(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
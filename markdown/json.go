@@ -0,0 +1,310 @@
+package markdown
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion is the version of the JSON document schema written by
+// MarshalDocument. It changes only when the schema does in a way that older
+// readers cannot handle, such as a renamed or retyped field; new optional
+// fields do not change it.
+const SchemaVersion = 1
+
+// schemaName identifies showboat documents in JSON.
+const schemaName = "showboat-document"
+
+// Each block is serialized as a JSON object with a "type" field holding its
+// Type() and snake_case fields. Optional fields are omitted when empty.
+
+type titleJSON struct {
+	Type       string        `json:"type"`
+	Title      string        `json:"title"`
+	Timestamp  string        `json:"timestamp"`
+	Version    string        `json:"version,omitempty"`
+	DocumentID string        `json:"id,omitempty"`
+	Metadata   *metadataJSON `json:"metadata,omitempty"`
+}
+
+type metadataJSON struct {
+	Author      string   `json:"author,omitempty"`
+	Agent       string   `json:"agent,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Commit      string   `json:"commit,omitempty"`
+	Description string   `json:"description,omitempty"`
+	ImageNames  string   `json:"image_names,omitempty"`
+	Assets      string   `json:"assets,omitempty"`
+	ImageBudget string   `json:"image_budget,omitempty"`
+	Sources     []string `json:"sources,omitempty"`
+	Extra       string   `json:"extra,omitempty"`
+}
+
+type commentaryJSON struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type headingJSON struct {
+	Type  string `json:"type"`
+	Level int    `json:"level"`
+	Title string `json:"title"`
+}
+
+type codeJSON struct {
+	Type          string `json:"type"`
+	Lang          string `json:"lang"`
+	Code          string `json:"code"`
+	Image         bool   `json:"image,omitempty"`
+	Run           bool   `json:"run,omitempty"`
+	Setup         bool   `json:"setup,omitempty"`
+	ExpectExit    int    `json:"expect_exit,omitempty"`
+	ExpectFailure bool   `json:"expect_failure,omitempty"`
+	Match         string `json:"match,omitempty"`
+	MaxWidth      int    `json:"max_width,omitempty"`
+	Quality       int    `json:"quality,omitempty"`
+	Strip         bool   `json:"strip,omitempty"`
+	Hash          bool   `json:"hash,omitempty"`
+}
+
+type outputJSON struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+type imageOutputJSON struct {
+	Type     string `json:"type"`
+	AltText  string `json:"alt"`
+	Filename string `json:"filename"`
+}
+
+// MarshalJSON encodes the block as {"type": "title", "title": ..., ...}.
+func (b TitleBlock) MarshalJSON() ([]byte, error) {
+	v := titleJSON{Type: b.Type(), Title: b.Title, Timestamp: b.Timestamp, Version: b.Version, DocumentID: b.DocumentID}
+	if m := b.Metadata; !m.IsZero() {
+		v.Metadata = &metadataJSON{
+			Author: m.Author, Agent: m.Agent, Tags: m.Tags, Commit: m.Commit, Description: m.Description,
+			ImageNames: m.ImageNames, Assets: m.Assets, ImageBudget: m.ImageBudget, Sources: m.Sources, Extra: m.Extra,
+		}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a block encoded by MarshalJSON.
+func (b *TitleBlock) UnmarshalJSON(data []byte) error {
+	var v titleJSON
+	if err := unmarshalTyped(data, b.Type(), &v); err != nil {
+		return err
+	}
+	*b = TitleBlock{Title: v.Title, Timestamp: v.Timestamp, Version: v.Version, DocumentID: v.DocumentID}
+	if m := v.Metadata; m != nil {
+		b.Metadata = Metadata{
+			Author: m.Author, Agent: m.Agent, Tags: m.Tags, Commit: m.Commit, Description: m.Description,
+			ImageNames: m.ImageNames, Assets: m.Assets, ImageBudget: m.ImageBudget, Sources: m.Sources, Extra: m.Extra,
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the block as {"type": "commentary", "text": ...}.
+func (b CommentaryBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(commentaryJSON{Type: b.Type(), Text: b.Text})
+}
+
+// UnmarshalJSON decodes a block encoded by MarshalJSON.
+func (b *CommentaryBlock) UnmarshalJSON(data []byte) error {
+	var v commentaryJSON
+	if err := unmarshalTyped(data, b.Type(), &v); err != nil {
+		return err
+	}
+	*b = CommentaryBlock{Text: v.Text}
+	return nil
+}
+
+// MarshalJSON encodes the block as {"type": "heading", "level": ..., ...}.
+func (b HeadingBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(headingJSON{Type: b.Type(), Level: b.Level, Title: b.Title})
+}
+
+// UnmarshalJSON decodes a block encoded by MarshalJSON.
+func (b *HeadingBlock) UnmarshalJSON(data []byte) error {
+	var v headingJSON
+	if err := unmarshalTyped(data, b.Type(), &v); err != nil {
+		return err
+	}
+	if v.Level < 2 || v.Level > 6 {
+		return fmt.Errorf("invalid heading level %d: must be 2 to 6", v.Level)
+	}
+	*b = HeadingBlock{Level: v.Level, Title: v.Title}
+	return nil
+}
+
+// MarshalJSON encodes the block as {"type": "code", "lang": ..., ...}.
+func (b CodeBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(codeJSON{
+		Type: b.Type(), Lang: b.Lang, Code: b.Code, Image: b.IsImage, Run: b.Run, Setup: b.Setup,
+		ExpectExit: b.ExpectExit, ExpectFailure: b.ExpectFailure, Match: b.Match,
+		MaxWidth: b.MaxWidth, Quality: b.Quality, Strip: b.Strip, Hash: b.Hash,
+	})
+}
+
+// UnmarshalJSON decodes a block encoded by MarshalJSON.
+func (b *CodeBlock) UnmarshalJSON(data []byte) error {
+	var v codeJSON
+	if err := unmarshalTyped(data, b.Type(), &v); err != nil {
+		return err
+	}
+	cb := CodeBlock{
+		Lang: v.Lang, Code: v.Code, IsImage: v.Image, Run: v.Run, Setup: v.Setup,
+		ExpectExit: v.ExpectExit, ExpectFailure: v.ExpectFailure, Match: v.Match,
+		MaxWidth: v.MaxWidth, Quality: v.Quality, Strip: v.Strip, Hash: v.Hash,
+	}
+	if err := cb.Validate(); err != nil {
+		return err
+	}
+	*b = cb
+	return nil
+}
+
+// MarshalJSON encodes the block as {"type": "output", "content": ...}.
+func (b OutputBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(outputJSON{Type: b.Type(), Content: b.Content})
+}
+
+// UnmarshalJSON decodes a block encoded by MarshalJSON.
+func (b *OutputBlock) UnmarshalJSON(data []byte) error {
+	var v outputJSON
+	if err := unmarshalTyped(data, b.Type(), &v); err != nil {
+		return err
+	}
+	*b = OutputBlock{Content: v.Content}
+	return nil
+}
+
+// MarshalJSON encodes the block as {"type": "output-image", "alt": ...,
+// "filename": ...}.
+func (b ImageOutputBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(imageOutputJSON{Type: b.Type(), AltText: b.AltText, Filename: b.Filename})
+}
+
+// UnmarshalJSON decodes a block encoded by MarshalJSON.
+func (b *ImageOutputBlock) UnmarshalJSON(data []byte) error {
+	var v imageOutputJSON
+	if err := unmarshalTyped(data, b.Type(), &v); err != nil {
+		return err
+	}
+	*b = ImageOutputBlock{AltText: v.AltText, Filename: v.Filename}
+	return nil
+}
+
+// unmarshalTyped decodes data into v, which must have a Type field, and
+// checks that the encoded type is want.
+func unmarshalTyped(data []byte, want string, v any) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	got, err := blockType(data)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("cannot decode %q block as %q", got, want)
+	}
+	return nil
+}
+
+// blockType returns the "type" field of an encoded block.
+func blockType(data []byte) (string, error) {
+	var v struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "", err
+	}
+	if v.Type == "" {
+		return "", fmt.Errorf("block has no type")
+	}
+	return v.Type, nil
+}
+
+// UnmarshalBlock decodes a single block of any type from JSON.
+func UnmarshalBlock(data []byte) (Block, error) {
+	t, err := blockType(data)
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case "title":
+		var b TitleBlock
+		err = b.UnmarshalJSON(data)
+		return b, err
+	case "commentary":
+		var b CommentaryBlock
+		err = b.UnmarshalJSON(data)
+		return b, err
+	case "heading":
+		var b HeadingBlock
+		err = b.UnmarshalJSON(data)
+		return b, err
+	case "code":
+		var b CodeBlock
+		err = b.UnmarshalJSON(data)
+		return b, err
+	case "output":
+		var b OutputBlock
+		err = b.UnmarshalJSON(data)
+		return b, err
+	case "output-image":
+		var b ImageOutputBlock
+		err = b.UnmarshalJSON(data)
+		return b, err
+	}
+	return nil, fmt.Errorf("unknown block type: %s", t)
+}
+
+// documentJSON is the JSON form of a whole document.
+type documentJSON struct {
+	Schema  string            `json:"schema"`
+	Version int               `json:"version"`
+	Blocks  []json.RawMessage `json:"blocks"`
+}
+
+// MarshalDocument encodes blocks as a JSON document:
+//
+//	{"schema": "showboat-document", "version": 1, "blocks": [...]}
+//
+// with each block encoded by its MarshalJSON method.
+func MarshalDocument(blocks []Block) ([]byte, error) {
+	doc := documentJSON{Schema: schemaName, Version: SchemaVersion, Blocks: []json.RawMessage{}}
+	for _, b := range blocks {
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		doc.Blocks = append(doc.Blocks, data)
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// UnmarshalDocument decodes a JSON document written by MarshalDocument. It
+// rejects documents written with a newer schema version.
+func UnmarshalDocument(data []byte) ([]Block, error) {
+	var doc documentJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Schema != schemaName {
+		return nil, fmt.Errorf("not a showboat document: schema is %q", doc.Schema)
+	}
+	if doc.Version < 1 || doc.Version > SchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %d (this showboat reads version %d)", doc.Version, SchemaVersion)
+	}
+	blocks := make([]Block, 0, len(doc.Blocks))
+	for i, raw := range doc.Blocks {
+		b, err := UnmarshalBlock(raw)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
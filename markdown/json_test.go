@@ -0,0 +1,86 @@
+package markdown
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDocumentJSONRoundTrip(t *testing.T) {
+	blocks := []Block{
+		TitleBlock{Title: "Demo", Timestamp: "2026-01-02T03:04:05Z", Version: "dev", DocumentID: "abc",
+			Metadata: Metadata{Author: "alice", Tags: []string{"x", "y"}, ImageNames: ImageNamesHash, Extra: "custom: 1\n"}},
+		CommentaryBlock{Text: "Some *text*"},
+		HeadingBlock{Level: 3, Title: "Part"},
+		CodeBlock{Lang: "bash", Code: "exit 2", Setup: true, ExpectExit: 2, Match: MatchContains},
+		OutputBlock{Content: "out\n"},
+		CodeBlock{Lang: "bash", Code: "make-chart", IsImage: true, Run: true},
+		ImageOutputBlock{AltText: "chart", Filename: "img/chart.png"},
+	}
+	data, err := MarshalDocument(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnmarshalDocument(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, blocks) {
+		t.Errorf("round trip changed blocks:\n got %+v\nwant %+v", got, blocks)
+	}
+}
+
+func TestBlockJSON(t *testing.T) {
+	tests := []struct {
+		block Block
+		want  string
+	}{
+		{TitleBlock{Title: "T", Timestamp: "now"}, `{"type":"title","title":"T","timestamp":"now"}`},
+		{CommentaryBlock{Text: "hi"}, `{"type":"commentary","text":"hi"}`},
+		{HeadingBlock{Level: 2, Title: "H"}, `{"type":"heading","level":2,"title":"H"}`},
+		{CodeBlock{Lang: "bash", Code: "ls", ExpectFailure: true}, `{"type":"code","lang":"bash","code":"ls","expect_failure":true}`},
+		{OutputBlock{}, `{"type":"output","content":""}`},
+		{ImageOutputBlock{AltText: "a", Filename: "f.png"}, `{"type":"output-image","alt":"a","filename":"f.png"}`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("got  %s\nwant %s", data, tt.want)
+		}
+		back, err := UnmarshalBlock(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(back, tt.block) {
+			t.Errorf("UnmarshalBlock(%s) = %+v", data, back)
+		}
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	var code CodeBlock
+	if err := json.Unmarshal([]byte(`{"type":"output","content":"x"}`), &code); err == nil {
+		t.Error("expected an error decoding an output block as code")
+	}
+	if _, err := UnmarshalBlock([]byte(`{"type":"video"}`)); err == nil || !strings.Contains(err.Error(), "unknown block type") {
+		t.Errorf("expected an unknown type error, got %v", err)
+	}
+	if _, err := UnmarshalBlock([]byte(`{"type":"heading","level":1,"title":"x"}`)); err == nil {
+		t.Error("expected an error for heading level 1")
+	}
+	for _, attrs := range []string{`"expect_exit":256`, `"expect_exit":-1`, `"max_width":-5`, `"quality":101`, `"quality":-1`} {
+		if err := json.Unmarshal([]byte(`{"type":"code","lang":"bash","code":"x",`+attrs+`}`), &code); err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("expected an error for %s, got %v", attrs, err)
+		}
+	}
+	if _, err := UnmarshalDocument([]byte(`{"schema":"showboat-document","version":2,"blocks":[]}`)); err == nil || !strings.Contains(err.Error(), "unsupported schema version 2") {
+		t.Errorf("expected a version error, got %v", err)
+	}
+	if _, err := UnmarshalDocument([]byte(`{"version":1,"blocks":[]}`)); err == nil {
+		t.Error("expected an error for a missing schema")
+	}
+}
@@ -3,24 +3,47 @@ package markdown
 import (
 	"bufio"
 	"io"
+	"strconv"
 	"strings"
 )
 
+// Span is the range of source lines a block was parsed from, as 1-based
+// line numbers: Start is its first line and End the line after its last.
+// The span of a code or output block includes its fences, that of a heading
+// its section marker, and that of the title its front matter.
+type Span struct {
+	Start, End int
+}
+
 // Parse reads markdown from r and returns a slice of Blocks.
 // The input is expected to be in the format produced by Write.
 func Parse(r io.Reader) ([]Block, error) {
+	blocks, _, err := ParseSpans(r)
+	return blocks, err
+}
+
+// ParseSpans is like Parse, and also returns the source lines of each block.
+func ParseSpans(r io.Reader) ([]Block, []Span, error) {
 	scanner := bufio.NewScanner(r)
 	var lines []string
 	for scanner.Scan() {
 		lines = append(lines, scanner.Text())
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var blocks []Block
+	var spans []Span
 	i := 0
 
+	// add appends a block that started at line index start and ends just
+	// before line index end.
+	add := func(b Block, start, end int) {
+		blocks = append(blocks, b)
+		spans = append(spans, Span{Start: start + 1, End: min(end, len(lines)) + 1})
+	}
+
 	// skipSeparator consumes a single blank line between blocks.
 	skipSeparator := func() {
 		if i < len(lines) && lines[i] == "" {
@@ -28,10 +51,52 @@ func Parse(r io.Reader) ([]Block, error) {
 		}
 	}
 
+	// Optional YAML front matter, only recognized when a title follows it.
+	var meta Metadata
+	var metaTitle string
+	frontMatter := false
+	if m, t, n, ok := parseFrontMatter(lines); ok {
+		j := n
+		if j < len(lines) && lines[j] == "" {
+			j++
+		}
+		if j < len(lines) && strings.HasPrefix(lines[j], "# ") {
+			meta, metaTitle, i = m, t, j
+			frontMatter = true
+		}
+	}
+
+	// inSetup is true between a setup <details> wrapper and its </details>.
+	inSetup := false
+
 	for i < len(lines) {
+		start := i
+
+		// Setup wrapper written around setup code blocks and their output.
+		if isSetupWrapper(lines, i) {
+			i += 2
+			inSetup = true
+			skipSeparator()
+			continue
+		}
+		if inSetup && lines[i] == setupClose {
+			i++
+			inSetup = false
+			skipSeparator()
+			continue
+		}
+
 		// Title block: only at the very beginning of the document.
 		if len(blocks) == 0 && strings.HasPrefix(lines[i], "# ") {
+			if frontMatter {
+				start = 0
+			}
 			title := lines[i][2:]
+			if metaTitle != "" {
+				// The front matter holds the full multi-line title; the
+				// heading is only a single-line rendering of it.
+				title = metaTitle
+			}
 			i++ // past "# ..." line
 			// Skip blank line between title and timestamp
 			if i < len(lines) && lines[i] == "" {
@@ -57,7 +122,7 @@ func Parse(r io.Reader) ([]Block, error) {
 				docID = strings.TrimSuffix(docID, " -->")
 				i++
 			}
-			blocks = append(blocks, TitleBlock{Title: title, Timestamp: ts, Version: ver, DocumentID: docID})
+			add(TitleBlock{Title: title, Timestamp: ts, Version: ver, DocumentID: docID, Metadata: meta}, start, i)
 			skipSeparator()
 			continue
 		}
@@ -86,39 +151,40 @@ func Parse(r io.Reader) ([]Block, error) {
 					i++
 				}
 				i++ // past closing fence
-				blocks = append(blocks, OutputBlock{Content: content.String()})
+				add(OutputBlock{Content: content.String()}, start, i)
 
 			default:
-				// Code block. Check for {image} suffix.
-				lang := info
-				isImage := false
-				if strings.HasSuffix(lang, " {image}") {
-					lang = strings.TrimSuffix(lang, " {image}")
-					isImage = true
-				}
+				// Code block, with optional {attributes} after the language.
+				cb := parseCodeInfo(info)
 				var codeLines []string
 				for i < len(lines) && lines[i] != closingFence {
 					codeLines = append(codeLines, lines[i])
 					i++
 				}
 				i++ // past closing fence
-				blocks = append(blocks, CodeBlock{
-					Lang:    lang,
-					Code:    strings.Join(codeLines, "\n"),
-					IsImage: isImage,
-				})
+				cb.Code = strings.Join(codeLines, "\n")
+				add(cb, start, i)
 			}
 
 			skipSeparator()
 			continue
 		}
 
+		// Section heading: ## Title followed by the section marker. Plain
+		// heading lines are left as commentary.
+		if level, title := parseHeading(lines[i]); level > 0 && i+1 < len(lines) && lines[i+1] == sectionMarker {
+			i += 2
+			add(HeadingBlock{Level: level, Title: title}, start, i)
+			skipSeparator()
+			continue
+		}
+
 		// Image output line: ![alt](filename) on its own line.
 		if strings.HasPrefix(lines[i], "![") {
 			alt, filename := parseImageRef(lines[i])
 			if filename != "" {
 				i++
-				blocks = append(blocks, ImageOutputBlock{AltText: alt, Filename: filename})
+				add(ImageOutputBlock{AltText: alt, Filename: filename}, start, i)
 				skipSeparator()
 				continue
 			}
@@ -130,11 +196,20 @@ func Parse(r io.Reader) ([]Block, error) {
 			if strings.HasPrefix(lines[i], "```") {
 				break
 			}
+			if inSetup && lines[i] == setupClose {
+				break
+			}
+			if isSetupWrapper(lines, i) {
+				break
+			}
 			if strings.HasPrefix(lines[i], "![") {
 				if _, fn := parseImageRef(lines[i]); fn != "" {
 					break
 				}
 			}
+			if level, _ := parseHeading(lines[i]); level > 0 && i+1 < len(lines) && lines[i+1] == sectionMarker {
+				break
+			}
 			textLines = append(textLines, lines[i])
 			i++
 		}
@@ -143,11 +218,104 @@ func Parse(r io.Reader) ([]Block, error) {
 			textLines = textLines[:len(textLines)-1]
 		}
 		if len(textLines) > 0 {
-			blocks = append(blocks, CommentaryBlock{Text: strings.Join(textLines, "\n")})
+			add(CommentaryBlock{Text: strings.Join(textLines, "\n")}, start, start+len(textLines))
+		}
+	}
+
+	return blocks, spans, nil
+}
+
+// isSetupWrapper reports whether lines[i] starts the <details> wrapper that
+// Write puts around a setup entry. The same lines in commentary are not a
+// wrapper, so the next non-blank line must open a {setup} code block.
+func isSetupWrapper(lines []string, i int) bool {
+	if i+1 >= len(lines) || lines[i] != setupOpen || lines[i+1] != setupSummary {
+		return false
+	}
+	j := i + 2
+	for j < len(lines) && lines[j] == "" {
+		j++
+	}
+	if j == len(lines) || !strings.HasPrefix(lines[j], "```") {
+		return false
+	}
+	return parseCodeInfo(strings.TrimLeft(lines[j], "`")).Setup
+}
+
+// parseCodeInfo parses a code fence info string such as "bash" or
+// "bash {image}" into a CodeBlock without code. The attribute group is only
+// recognized when every attribute in it is known; otherwise the whole info
+// string is kept as the language so that it round-trips unchanged.
+func parseCodeInfo(info string) CodeBlock {
+	cb := CodeBlock{Lang: info}
+	open := strings.LastIndex(info, " {")
+	if open == -1 || !strings.HasSuffix(info, "}") {
+		return cb
+	}
+	attrs := strings.Fields(info[open+2 : len(info)-1])
+	if len(attrs) == 0 {
+		return cb
+	}
+	parsed := CodeBlock{Lang: info[:open]}
+	for _, attr := range attrs {
+		key, value, hasValue := strings.Cut(attr, "=")
+		switch {
+		case key == "image" && !hasValue:
+			parsed.IsImage = true
+		case key == "run" && !hasValue:
+			parsed.Run = true
+		case key == "setup" && !hasValue:
+			parsed.Setup = true
+		case key == "expect-failure" && !hasValue:
+			parsed.ExpectFailure = true
+		case key == "expect-exit" && hasValue:
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > MaxExitCode {
+				return cb
+			}
+			parsed.ExpectExit = n
+		case key == "max-width" && hasValue:
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return cb
+			}
+			parsed.MaxWidth = n
+		case key == "quality" && hasValue:
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 || n > 100 {
+				return cb
+			}
+			parsed.Quality = n
+		case key == "strip" && !hasValue:
+			parsed.Strip = true
+		case key == "hash" && !hasValue:
+			parsed.Hash = true
+		case key == "match" && hasValue:
+			if !IsMatchMode(value) {
+				return cb
+			}
+			parsed.Match = value
+		default:
+			return cb
 		}
 	}
+	return parsed
+}
 
-	return blocks, nil
+// parseHeading returns the level and text of a "## Title" style heading line
+// with two to six # characters. The level is 0 if line is not a heading.
+func parseHeading(line string) (level int, title string) {
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level < 2 || level > 6 || level >= len(line) || line[level] != ' ' {
+		return 0, ""
+	}
+	title = strings.TrimSpace(line[level+1:])
+	if title == "" {
+		return 0, ""
+	}
+	return level, title
 }
 
 // parseImageRef extracts the alt text and filename from a markdown image
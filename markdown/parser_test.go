@@ -272,3 +272,238 @@ func TestRoundTrip(t *testing.T) {
 		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
 	}
 }
+
+func TestParseHeading(t *testing.T) {
+	input := "# Demo\n\n*2026-02-06T00:00:00Z*\n\n## Setup\n<!-- showboat-section -->\n\n```bash\necho hi\n```\n\n```output\nhi\n```\n\n### Details\n<!-- showboat-section -->\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 5 {
+		t.Fatalf("expected 5 blocks, got %d: %+v", len(blocks), blocks)
+	}
+	h, ok := blocks[1].(HeadingBlock)
+	if !ok {
+		t.Fatalf("expected HeadingBlock, got %T", blocks[1])
+	}
+	if h.Level != 2 || h.Title != "Setup" {
+		t.Errorf("unexpected heading: %+v", h)
+	}
+	h, ok = blocks[4].(HeadingBlock)
+	if !ok {
+		t.Fatalf("expected HeadingBlock, got %T", blocks[4])
+	}
+	if h.Level != 3 || h.Title != "Details" {
+		t.Errorf("unexpected heading: %+v", h)
+	}
+}
+
+func TestParseHeadingInsideCommentary(t *testing.T) {
+	// Headings without the section marker stay part of the commentary, even
+	// when they stand alone between blank lines.
+	for _, input := range []string{
+		"Intro.\n## Not a section\nMore text.\n",
+		"Intro text.\n\n## Results\n\nMore text.\n",
+	} {
+		blocks, err := Parse(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blocks) != 1 {
+			t.Fatalf("expected 1 block, got %d: %+v", len(blocks), blocks)
+		}
+		cb, ok := blocks[0].(CommentaryBlock)
+		if !ok {
+			t.Fatalf("expected CommentaryBlock, got %T", blocks[0])
+		}
+		if cb.Text+"\n" != input {
+			t.Errorf("expected text %q, got %q", input, cb.Text)
+		}
+	}
+}
+
+func TestRoundTripHeadings(t *testing.T) {
+	input := "# Demo\n\n*2026-02-06T00:00:00Z*\n\nIntro.\n\n## Part one\n<!-- showboat-section -->\n\nSome text.\n\n#### Deep\n<!-- showboat-section -->\n\n```bash\necho hi\n```\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 6 {
+		t.Fatalf("expected 6 blocks, got %d: %+v", len(blocks), blocks)
+	}
+	var buf strings.Builder
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
+	}
+}
+
+func TestParseSetupBlock(t *testing.T) {
+	input := "Intro.\n\n<details>\n<summary>Setup</summary>\n\n```bash {setup}\nmkdir -p fixtures\n```\n\n```output\n```\n\n</details>\n\nDone.\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 4 {
+		t.Fatalf("expected 4 blocks, got %d: %+v", len(blocks), blocks)
+	}
+	code, ok := blocks[1].(CodeBlock)
+	if !ok {
+		t.Fatalf("expected CodeBlock, got %T", blocks[1])
+	}
+	if !code.Setup || code.Lang != "bash" || code.Code != "mkdir -p fixtures" {
+		t.Errorf("unexpected code block: %+v", code)
+	}
+	if cb, ok := blocks[3].(CommentaryBlock); !ok || cb.Text != "Done." {
+		t.Errorf("expected trailing commentary, got %+v", blocks[3])
+	}
+
+	var buf strings.Builder
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
+	}
+}
+
+func TestParseSetupLinesInCommentary(t *testing.T) {
+	// A note may contain the lines of the setup wrapper; without a {setup}
+	// code block after them they are kept as commentary.
+	note := "<details>\n<summary>Setup</summary>\n\nRun make deps first.\n\n</details>"
+	input := "# Demo\n\n*2026-02-06T00:00:00Z*\n\n" + note + "\n\n```bash\necho hi\n```\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("expected 3 blocks, got %d: %+v", len(blocks), blocks)
+	}
+	if cb, ok := blocks[1].(CommentaryBlock); !ok || cb.Text != note {
+		t.Errorf("expected commentary %q, got %+v", note, blocks[1])
+	}
+
+	var buf strings.Builder
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
+	}
+}
+
+func TestParseUnknownAttributesKeptInLang(t *testing.T) {
+	input := "```python {linenos}\nprint(1)\n```\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := blocks[0].(CodeBlock)
+	if code.Lang != "python {linenos}" || code.IsImage || code.Setup {
+		t.Errorf("unexpected code block: %+v", code)
+	}
+}
+
+func TestParseExpectExitAttributes(t *testing.T) {
+	input := "```bash {expect-exit=2}\nexit 2\n```\n\n```bash {setup expect-failure}\nfalse\n```\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The setup block has no output, so it is not wrapped; that is fine for
+	// parsing attributes.
+	first := blocks[0].(CodeBlock)
+	if first.ExpectExit != 2 || first.ExpectFailure {
+		t.Errorf("unexpected first block: %+v", first)
+	}
+	second := blocks[1].(CodeBlock)
+	if !second.Setup || !second.ExpectFailure || second.Lang != "bash" {
+		t.Errorf("unexpected second block: %+v", second)
+	}
+}
+
+func TestParseOutOfRangeAttributesKeptInLang(t *testing.T) {
+	for _, info := range []string{"bash {expect-exit=256}", "bash {expect-exit=-1}", "bash {image quality=101}", "bash {image max-width=-5}"} {
+		blocks, err := Parse(strings.NewReader("```" + info + "\nexit 1\n```\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code := blocks[0].(CodeBlock); code.Lang != info || code.ExpectExit != 0 || code.Quality != 0 || code.MaxWidth != 0 {
+			t.Errorf("expected %q to be kept as the language, got %+v", info, code)
+		}
+	}
+}
+
+func TestParseMatchAttribute(t *testing.T) {
+	input := "```bash {match=lines-unordered}\nls\n```\n\n```bash {match=fuzzy}\nls\n```\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := blocks[0].(CodeBlock)
+	if first.Match != MatchLinesUnordered || first.Lang != "bash" {
+		t.Errorf("unexpected first block: %+v", first)
+	}
+	// Unknown modes leave the info string untouched.
+	second := blocks[1].(CodeBlock)
+	if second.Match != "" || second.Lang != "bash {match=fuzzy}" {
+		t.Errorf("unexpected second block: %+v", second)
+	}
+}
+
+func TestParseImageRunAttribute(t *testing.T) {
+	input := "```bash {image run}\npython chart.py && echo chart.png\n```\n\n![chart](abc-2026-02-06.png)\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := blocks[0].(CodeBlock)
+	if !code.IsImage || !code.Run || code.Lang != "bash" {
+		t.Errorf("unexpected code block: %+v", code)
+	}
+	var buf strings.Builder
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
+	}
+}
+
+func TestParseImageStorageAttributes(t *testing.T) {
+	input := "```bash {image max-width=800 quality=75 strip hash}\nchart.png\n```\n\n![chart](abc.png)\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := blocks[0].(CodeBlock)
+	if !code.IsImage || code.MaxWidth != 800 || code.Quality != 75 || !code.Strip || !code.Hash || code.Lang != "bash" {
+		t.Errorf("unexpected code block: %+v", code)
+	}
+	var buf strings.Builder
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
+	}
+}
+
+func TestParseSpans(t *testing.T) {
+	input := "---\nauthor: Ann\n---\n\n# Demo\n\n*2026-02-06T00:00:00Z*\n\n\nTwo\nlines.\n\n\n## Part\n<!-- showboat-section -->\n\n```bash\necho hi\n```\n\n```output\nhi\n```\n\n![chart](a.png)\n"
+	blocks, spans, err := ParseSpans(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Span{{1, 8}, {9, 12}, {14, 16}, {17, 20}, {21, 24}, {25, 26}}
+	if len(blocks) != len(want) || len(spans) != len(want) {
+		t.Fatalf("expected %d blocks and spans, got %d and %d: %+v", len(want), len(blocks), len(spans), blocks)
+	}
+	for i := range want {
+		if spans[i] != want[i] {
+			t.Errorf("block %d (%s): expected span %v, got %v", i, blocks[i].Type(), want[i], spans[i])
+		}
+	}
+}
@@ -6,7 +6,19 @@ import (
 	"strings"
 )
 
+// Lines of the <details> wrapper that collapses setup code blocks.
+const (
+	setupOpen    = "<details>"
+	setupSummary = "<summary>Setup</summary>"
+	setupClose   = "</details>"
+)
+
+// sectionMarker follows the line of a section heading, telling it apart from
+// a heading written as part of commentary.
+const sectionMarker = "<!-- showboat-section -->"
+
 // Write serializes a slice of Blocks to markdown, writing the result to w.
+// Setup code blocks and their output are wrapped in a <details> element.
 func Write(w io.Writer, blocks []Block) error {
 	for i, block := range blocks {
 		if i > 0 {
@@ -14,21 +26,66 @@ func Write(w io.Writer, blocks []Block) error {
 				return err
 			}
 		}
+		if cb, ok := block.(CodeBlock); ok && cb.Setup {
+			if _, err := fmt.Fprintf(w, "%s\n%s\n\n", setupOpen, setupSummary); err != nil {
+				return err
+			}
+		}
 		if err := writeBlock(w, block); err != nil {
 			return err
 		}
+		if endsSetup(blocks, i) {
+			if _, err := fmt.Fprintf(w, "\n%s\n", setupClose); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+// endsSetup reports whether blocks[i] is the last block of a setup entry:
+// either the output following a setup code block, or a setup code block
+// with no output.
+func endsSetup(blocks []Block, i int) bool {
+	switch blocks[i].(type) {
+	case OutputBlock, ImageOutputBlock:
+		if i > 0 {
+			cb, ok := blocks[i-1].(CodeBlock)
+			return ok && cb.Setup
+		}
+		return false
+	case CodeBlock:
+		if !blocks[i].(CodeBlock).Setup {
+			return false
+		}
+		if i+1 < len(blocks) {
+			switch blocks[i+1].(type) {
+			case OutputBlock, ImageOutputBlock:
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 func writeBlock(w io.Writer, block Block) error {
 	switch b := block.(type) {
 	case TitleBlock:
+		if err := writeFrontMatter(w, b); err != nil {
+			return err
+		}
 		dateline := b.Timestamp
 		if b.Version != "" {
 			dateline += " by Showboat " + b.Version
 		}
-		if _, err := fmt.Fprintf(w, "# %s\n\n*%s*\n", b.Title, dateline); err != nil {
+		// A multi-line title is kept in the front matter and shown here
+		// on a single line.
+		heading := strings.Join(strings.Fields(b.Title), " ")
+		if !strings.Contains(b.Title, "\n") {
+			heading = b.Title
+		}
+		if _, err := fmt.Fprintf(w, "# %s\n\n*%s*\n", heading, dateline); err != nil {
 			return err
 		}
 		if b.DocumentID != "" {
@@ -40,12 +97,15 @@ func writeBlock(w io.Writer, block Block) error {
 	case CommentaryBlock:
 		_, err := fmt.Fprintf(w, "%s\n", b.Text)
 		return err
-	case CodeBlock:
-		lang := b.Lang
-		if b.IsImage {
-			lang += " {image}"
+	case HeadingBlock:
+		level := b.Level
+		if level < 2 || level > 6 {
+			level = 2
 		}
-		_, err := fmt.Fprintf(w, "```%s\n%s\n```\n", lang, b.Code)
+		_, err := fmt.Fprintf(w, "%s %s\n%s\n", strings.Repeat("#", level), b.Title, sectionMarker)
+		return err
+	case CodeBlock:
+		_, err := fmt.Fprintf(w, "```%s\n%s\n```\n", codeInfo(b), b.Code)
 		return err
 	case OutputBlock:
 		fence := fenceFor(b.Content)
@@ -59,6 +119,45 @@ func writeBlock(w io.Writer, block Block) error {
 	}
 }
 
+// codeInfo returns the fence info string for a code block: the language
+// followed by any attributes in braces, e.g. "bash {image}".
+func codeInfo(b CodeBlock) string {
+	var attrs []string
+	if b.IsImage {
+		attrs = append(attrs, "image")
+	}
+	if b.Run {
+		attrs = append(attrs, "run")
+	}
+	if b.Setup {
+		attrs = append(attrs, "setup")
+	}
+	if b.ExpectExit != 0 {
+		attrs = append(attrs, fmt.Sprintf("expect-exit=%d", b.ExpectExit))
+	} else if b.ExpectFailure {
+		attrs = append(attrs, "expect-failure")
+	}
+	if b.Match != "" && b.Match != MatchExact {
+		attrs = append(attrs, "match="+b.Match)
+	}
+	if b.MaxWidth != 0 {
+		attrs = append(attrs, fmt.Sprintf("max-width=%d", b.MaxWidth))
+	}
+	if b.Quality != 0 {
+		attrs = append(attrs, fmt.Sprintf("quality=%d", b.Quality))
+	}
+	if b.Strip {
+		attrs = append(attrs, "strip")
+	}
+	if b.Hash {
+		attrs = append(attrs, "hash")
+	}
+	if len(attrs) == 0 {
+		return b.Lang
+	}
+	return b.Lang + " {" + strings.Join(attrs, " ") + "}"
+}
+
 // fenceFor returns a backtick fence string (at least 3 backticks) that is
 // longer than any backtick sequence found at the start of a line in content.
 func fenceFor(content string) string {
@@ -176,3 +176,32 @@ func TestWriteFullDocument(t *testing.T) {
 		t.Errorf("expected:\n%q\ngot:\n%q", expected, buf.String())
 	}
 }
+
+func TestWriteHeading(t *testing.T) {
+	var buf strings.Builder
+	blocks := []Block{
+		HeadingBlock{Level: 3, Title: "Setup"},
+	}
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	expected := "### Setup\n<!-- showboat-section -->\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, buf.String())
+	}
+}
+
+func TestWriteSetupWithoutOutput(t *testing.T) {
+	var buf strings.Builder
+	blocks := []Block{
+		CodeBlock{Lang: "bash", Code: "touch a", Setup: true},
+		CommentaryBlock{Text: "Next."},
+	}
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	expected := "<details>\n<summary>Setup</summary>\n\n```bash {setup}\ntouch a\n```\n\n</details>\n\nNext.\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, buf.String())
+	}
+}